@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+type branchInfo struct {
+	Name     string    `json:"name"`
+	Commit   string    `json:"commit"`
+	Subject  string    `json:"subject"`
+	Time     time.Time `json:"time"`
+	Current  bool      `json:"current"`
+	Worktree string    `json:"worktree"` // dir of another worktree that the branch is checked out in
+
+	Ahead  int `json:"ahead"`  // commits ahead of the main branch
+	Behind int `json:"behind"` // commits behind the main branch
+
+	Upstream       string `json:"upstream"`
+	UpstreamAhead  int    `json:"upstream_ahead"`
+	UpstreamBehind int    `json:"upstream_behind"`
+	UpstreamGone   bool   `json:"upstream_gone"`
+
+	PR      int    `json:"pr"`
+	PRState string `json:"pr_state"`
+	CI      string `json:"ci"` // pass, fail or pending
+
+	Parent string `json:"parent"` // the branch it is stacked on
+}
+
+var trackRe = regexp.MustCompile(`(ahead|behind) ([0-9]+)`)
+
+func readBranches() []branchInfo {
+	wd := RepoDir()
+	prs := readPRCache().PRs
+	format := "%(HEAD)%00%(refname:short)%00%(objectname:short)%00%(committerdate:unix)%00%(worktreepath)%00%(upstream:short)%00%(upstream:track,nobracket)%00%(contents:subject)"
+	s := sh("git for-each-ref --format='%s' refs/heads", format)
+
+	bis := []branchInfo{}
+	for _, ln := range strings.Split(s, "\n") {
+		fs := strings.Split(ln, "\x00")
+		if len(fs) != 8 {
+			continue
+		}
+		ts, _ := strconv.ParseInt(fs[3], 10, 64)
+		bi := branchInfo{
+			Name:     fs[1],
+			Commit:   fs[2],
+			Time:     time.Unix(ts, 0),
+			Current:  fs[0] == "*",
+			Upstream: fs[5],
+			Subject:  fs[7],
+		}
+		if fs[4] != "" && fs[4] != wd {
+			bi.Worktree = fs[4]
+		}
+		bi.UpstreamGone = fs[6] == "gone"
+		for _, m := range trackRe.FindAllStringSubmatch(fs[6], -1) {
+			n, _ := strconv.Atoi(m[2])
+			if m[1] == "ahead" {
+				bi.UpstreamAhead = n
+			} else {
+				bi.UpstreamBehind = n
+			}
+		}
+		if cp, ok := prs[bi.Name]; ok {
+			bi.PR, bi.PRState, bi.CI = cp.Number, cp.State, cp.CI
+		}
+		bis = append(bis, bi)
+	}
+	return bis
+}
+
+func listBranches() []branchInfo {
+	bm := MainBranch()
+	bis := readBranches()
+	for i, bi := range bis {
+		if bi.Name != bm {
+			lr := strings.Fields(sh("git rev-list --left-right --count %s...%s", bm, bi.Name))
+			bis[i].Behind, _ = strconv.Atoi(lr[0])
+			bis[i].Ahead, _ = strconv.Atoi(lr[1])
+		}
+		if cp, ok := lookupPR(bi.Name); ok {
+			bis[i].PR, bis[i].PRState, bis[i].CI = cp.Number, cp.State, cp.CI
+		}
+	}
+
+	ahead := make(map[string]int)
+	for _, bi := range bis {
+		ahead[bi.Name] = bi.Ahead
+	}
+	for i, bi := range bis {
+		if bi.Ahead == 0 {
+			continue
+		}
+		best := 0
+		for _, b := range strings.Split(sh("git for-each-ref --merged %s --format='%%(refname:short)' refs/heads", bi.Name), "\n") {
+			if n := ahead[b]; n > best && n < bi.Ahead {
+				bis[i].Parent, best = b, n
+			}
+		}
+	}
+	return bis
+}
+
+func staleAge() time.Duration {
+	s := gitConfig("staleAge", "720h")
+	return check.V(time.ParseDuration(s)).F("invalid mygit.staleAge", "age", s)
+}
+
+func (bi branchInfo) stale() bool {
+	return time.Since(bi.Time) > staleAge() || bi.PRState == "MERGED" || bi.PRState == "CLOSED" || bi.UpstreamGone
+}
+
+func age(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	default:
+		return fmt.Sprintf("%dw", int(d.Hours()/24/7))
+	}
+}
+
+const (
+	colorReset   = "\033[0m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorMagenta = "\033[35m"
+	colorDim     = "\033[2m"
+)
+
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func branchTable(bis []branchInfo, color bool) string {
+	type cell struct{ text, color string }
+	var rows [][]cell
+	for _, bi := range bis {
+		mark := " "
+		if bi.Current {
+			mark = "*"
+		} else if bi.Worktree != "" {
+			mark = "+"
+		}
+		nameColor := ""
+		switch {
+		case bi.Current:
+			nameColor = colorGreen
+		case bi.stale():
+			nameColor = colorDim
+		}
+
+		trunk := ""
+		if bi.Ahead > 0 || bi.Behind > 0 {
+			trunk = fmt.Sprintf("+%d -%d", bi.Ahead, bi.Behind)
+		}
+		up := ""
+		switch {
+		case bi.UpstreamGone:
+			up = "gone"
+		case bi.Upstream != "":
+			up = fmt.Sprintf("↑%d ↓%d", bi.UpstreamAhead, bi.UpstreamBehind)
+		}
+
+		pr, prColor := "", ""
+		if bi.PR > 0 {
+			pr = fmt.Sprintf("#%d %s", bi.PR, bi.PRState)
+			prColor = map[string]string{"OPEN": colorGreen, "MERGED": colorMagenta, "CLOSED": colorRed}[bi.PRState]
+		}
+		ciColor := map[string]string{"pass": colorGreen, "fail": colorRed, "pending": colorYellow}[bi.CI]
+
+		rows = append(rows, []cell{
+			{mark, nameColor}, {bi.Name, nameColor}, {bi.Commit, colorYellow}, {trunk, ""}, {up, ""},
+			{pr, prColor}, {bi.CI, ciColor}, {bi.Parent, ""}, {age(bi.Time), ""}, {bi.Subject, ""},
+		})
+	}
+
+	widths := make([]int, 10)
+	for _, row := range rows {
+		for i, c := range row {
+			widths[i] = max(widths[i], len([]rune(c.text)))
+		}
+	}
+	var sb strings.Builder
+	for _, row := range rows {
+		for i, c := range row {
+			if widths[i] == 0 {
+				continue
+			}
+			text := c.text
+			if i < len(row)-1 {
+				text += strings.Repeat(" ", widths[i]-len([]rune(c.text))+1)
+			}
+			if color && c.color != "" {
+				text = c.color + text + colorReset
+			}
+			sb.WriteString(text)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func (OpList) BB_Branch() {
+	mine := flag.Bool("mine", false, "my branches only")
+	stale := flag.Bool("stale", false, "stale branches only")
+	openPR := flag.Bool("open-pr", false, "branches with open pr only")
+	sortBy := flag.String("sort", "name", "sort by name, age or ahead")
+	mygo.ParseFlag()
+
+	bis := listBranches()
+	prefix := Username() + "/"
+	bis = slices.DeleteFunc(bis, func(bi branchInfo) bool {
+		return (*mine && !strings.HasPrefix(bi.Name, prefix)) ||
+			(*stale && !bi.stale()) ||
+			(*openPR && bi.PRState != "OPEN")
+	})
+	switch *sortBy {
+	case "name":
+	case "age":
+		slices.SortStableFunc(bis, func(a, b branchInfo) int { return b.Time.Compare(a.Time) })
+	case "ahead":
+		slices.SortStableFunc(bis, func(a, b branchInfo) int { return b.Ahead - a.Ahead })
+	default:
+		check.F("invalid sort", "sort", *sortBy)
+	}
+	if *jsonOut {
+		printJSON(bis)
+		return
+	}
+	fmt.Println(branchTable(bis, useColor()))
+}
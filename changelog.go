@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+var changeGroups = []struct{ Type, Title string }{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance"},
+	{"refactor", "Refactoring"},
+	{"docs", "Documentation"},
+}
+
+const (
+	breakingTitle = "Breaking Changes"
+	otherTitle    = "Other Changes"
+)
+
+type changelogGroup struct {
+	Title   string       `json:"title"`
+	Commits []convCommit `json:"commits"`
+}
+
+func dedupePRs(ccs []convCommit) []convCommit {
+	seen := make(map[int]bool)
+	var out []convCommit
+	for _, cc := range ccs {
+		if cc.PR > 0 {
+			if seen[cc.PR] {
+				continue
+			}
+			seen[cc.PR] = true
+		}
+		out = append(out, cc)
+	}
+	return out
+}
+
+func groupChanges(ccs []convCommit, byLabel bool) []changelogGroup {
+	ccs = dedupePRs(ccs)
+	titles := []string{breakingTitle}
+	if byLabel {
+		order := configValues("mygit.changelogLabel")
+		if len(order) == 0 {
+			for _, cc := range ccs {
+				order = append(order, cc.Labels...)
+			}
+			slices.Sort(order)
+			order = slices.Compact(order)
+		}
+		titles = append(titles, order...)
+	} else {
+		for _, g := range changeGroups {
+			titles = append(titles, g.Title)
+		}
+	}
+	titles = append(titles, otherTitle)
+
+	groupOf := func(cc convCommit) string {
+		if cc.Breaking {
+			return breakingTitle
+		}
+		if byLabel {
+			for _, l := range cc.Labels {
+				if slices.Contains(titles, l) {
+					return l
+				}
+			}
+			return otherTitle
+		}
+		for _, g := range changeGroups {
+			if g.Type == cc.Type {
+				return g.Title
+			}
+		}
+		return otherTitle
+	}
+
+	m := make(map[string][]convCommit)
+	for _, cc := range ccs {
+		g := groupOf(cc)
+		m[g] = append(m[g], cc)
+	}
+	groups := []changelogGroup{}
+	for _, t := range titles {
+		if len(m[t]) > 0 {
+			groups = append(groups, changelogGroup{Title: t, Commits: m[t]})
+			delete(m, t)
+		}
+	}
+	return groups
+}
+
+var remoteURLRe = regexp.MustCompile(`^(?:[a-z+]+://)?(?:[^@/]+@)?([^:/]+)[:/](.+?)(?:\.git)?/?$`)
+
+func repoURL() string {
+	mo := remoteURLRe.FindStringSubmatch(shQ("git remote get-url origin"))
+	if mo == nil {
+		return ""
+	}
+	return fmt.Sprintf("https://%s/%s", mo[1], mo[2])
+}
+
+func changelogSection(version string, date time.Time, groups []changelogGroup, url string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s (%s)\n", version, date.Format(time.DateOnly))
+	for _, g := range groups {
+		fmt.Fprintf(&sb, "\n### %s\n\n", g.Title)
+		for _, cc := range g.Commits {
+			ln := cc.Subject
+			if cc.Scope != "" {
+				ln = fmt.Sprintf("**%s:** %s", cc.Scope, ln)
+			}
+			switch {
+			case cc.PR > 0 && url != "":
+				ln += fmt.Sprintf(" ([#%d](%s/pull/%d))", cc.PR, url, cc.PR)
+			case cc.PR > 0:
+				ln += fmt.Sprintf(" (#%d)", cc.PR)
+			default:
+				ln += fmt.Sprintf(" (%s)", cc.Hash)
+			}
+			fmt.Fprintf(&sb, "- %s\n", ln)
+		}
+	}
+	return sb.String()
+}
+
+const changelogFile = "CHANGELOG.md"
+
+func prependChangelog(section string) string {
+	fn := filepath.Join(RepoDir(), changelogFile)
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		check.T(os.IsNotExist(err)).F("read changelog", "file", fn, "err", err)
+		b = []byte("# Changelog\n")
+	}
+	s := string(b)
+	heading, _, _ := strings.Cut(section, "\n")
+	check.T(!strings.Contains(s, heading+"\n")).F("section already in changelog", "heading", heading)
+
+	var head string
+	if strings.HasPrefix(s, "# ") {
+		ln, rest, _ := strings.Cut(s, "\n")
+		head, s = ln+"\n\n", strings.TrimLeft(rest, "\n")
+	}
+	s = head + section + "\n" + s
+	check.E(os.WriteFile(fn, []byte(strings.TrimRight(s, "\n")+"\n"), 0o644)).F("write changelog", "file", fn)
+	return fn
+}
+
+func (OpList) TC_Changelog() {
+	byLabel := flag.Bool("l", false, "group by pr label instead of commit type")
+	title := flag.String("t", "", "section title, default to the to tag or Unreleased")
+	write := flag.Bool("w", false, "prepend to "+changelogFile)
+	mygo.ParseFlag("from", "[to]")
+	check.T(flag.NArg() >= 1).F("missing from")
+
+	from, to := unaliasHead(flag.Arg(0)), "HEAD"
+	if flag.NArg() > 1 {
+		to = unaliasHead(flag.Arg(1))
+	}
+	ccs := releaseCommits(fmt.Sprintf("%s..%s", from, to))
+	if *byLabel {
+		var prs []int
+		for _, cc := range dedupePRs(ccs) {
+			if cc.PR > 0 {
+				prs = append(prs, cc.PR)
+			}
+		}
+		labels := prLabels(prs)
+		for i := range ccs {
+			if ls := labels[ccs[i].PR]; ls != nil {
+				ccs[i].Labels = ls
+			}
+		}
+	}
+
+	version, date := *title, time.Now()
+	if version == "" {
+		version = "Unreleased"
+		if _, ok := parseSemver(to); ok {
+			version = to
+			ct, _ := strconv.ParseInt(sh("git log -n 1 --format=%%ct %s", to), 10, 64)
+			date = time.Unix(ct, 0)
+		}
+	}
+	groups := groupChanges(ccs, *byLabel)
+
+	if *jsonOut {
+		printJSON(struct {
+			Version string           `json:"version"`
+			Date    string           `json:"date"`
+			From    string           `json:"from"`
+			To      string           `json:"to"`
+			Groups  []changelogGroup `json:"groups"`
+		}{version, date.Format(time.DateOnly), from, to, groups})
+		return
+	}
+	section := changelogSection(version, date, groups, repoURL())
+	if *write {
+		log.Printf("prepended %s to %s", version, prependChangelog(section))
+		return
+	}
+	fmt.Print(section)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncoder/mygo"
+)
+
+var defaultKeepList = []string{".env", ".env.*", "*.local"}
+
+func keepList() []string {
+	if ks := configValues("mygit.keep"); len(ks) > 0 {
+		return ks
+	}
+	return defaultKeepList
+}
+
+func cleanArgs(dirs, ignored, keep bool, pathspecs []string) []string {
+	var args []string
+	if dirs {
+		args = append(args, "-d")
+	}
+	if ignored {
+		args = append(args, "-x")
+	}
+	if keep {
+		for _, k := range keepList() {
+			args = append(args, "-e", k)
+		}
+	}
+	if len(pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, pathspecs...)
+	}
+	return args
+}
+
+func cleanCandidates(args []string) []string {
+	var paths []string
+	s := gitOut(append([]string{"-c", "core.quotePath=false", "clean", "-n"}, args...)...)
+	for _, ln := range strings.Split(s, "\n") {
+		if p, ok := strings.CutPrefix(ln, "Would remove "); ok {
+			// paths with quotes or control characters are still quoted
+			if uq, err := strconv.Unquote(p); err == nil && strings.HasPrefix(p, `"`) {
+				p = uq
+			}
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func pathSize(p string) int64 {
+	var size int64
+	filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func chooseCleanPaths(paths []string, sizes map[string]int64) []string {
+	p := prompter{r: bufio.NewReader(os.Stdin)}
+	var chosen []string
+	for i, path := range paths {
+		switch p.ask(fmt.Sprintf("remove %s (%s) (y/n/a/q)", path, humanSize(sizes[path])), "n") {
+		case "y":
+			chosen = append(chosen, path)
+		case "a":
+			return append(chosen, paths[i:]...)
+		case "q":
+			return chosen
+		}
+	}
+	return chosen
+}
+
+func (OpList) MX_Clean() {
+	dirs := flag.Bool("d", false, "remove untracked directories too")
+	ignored := flag.Bool("x", false, "remove ignored files too, e.g. build outputs")
+	interactive := flag.Bool("i", false, "choose the paths to remove one by one")
+	dryRun := flag.Bool("n", false, "show what would be removed and the size only")
+	mygo.ParseFlag("[glob...]")
+
+	// clean -n lists exactly what clean -f removes
+	paths := cleanCandidates(cleanArgs(*dirs, *ignored, true, flag.Args()))
+	var kept []string
+	for _, p := range cleanCandidates(cleanArgs(*dirs, *ignored, false, flag.Args())) {
+		if !slices.Contains(paths, p) {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) > 0 {
+		log.Printf("keep-list %v keeps %s", keepList(), strings.Join(kept, " "))
+	}
+	if len(paths) == 0 {
+		log.Println("no file to clean")
+		return
+	}
+
+	sizes := make(map[string]int64)
+	var total int64
+	for _, p := range paths {
+		sizes[p] = pathSize(p)
+		total += sizes[p]
+	}
+	if *interactive {
+		paths = chooseCleanPaths(paths, sizes)
+		if len(paths) == 0 {
+			return
+		}
+		total = 0
+		for _, p := range paths {
+			total += sizes[p]
+		}
+	}
+
+	var sb strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&sb, "%8s  %s\n", humanSize(sizes[p]), p)
+	}
+	fmt.Fprintf(&sb, "%8s  total in %d paths", humanSize(total), len(paths))
+	if *dryRun {
+		fmt.Println(sb.String())
+		return
+	}
+	if !*interactive {
+		mygo.Yorn("delete these files?\n%s\n", sb.String())
+	}
+
+	// ignored files are build outputs that can be regenerated, and are not saved to trash
+	var trash []string
+	if *ignored {
+		untracked := cleanCandidates(cleanArgs(*dirs, false, true, paths))
+		for _, p := range paths {
+			if slices.Contains(untracked, p) {
+				trash = append(trash, p)
+			}
+		}
+		if n := len(paths) - len(trash); n > 0 {
+			log.Printf("not saving %d ignored paths to trash", n)
+		}
+	} else {
+		trash = paths
+	}
+	if len(trash) > 0 {
+		trashFiles("mx", trash)
+	}
+
+	var literal []string
+	for _, p := range paths {
+		literal = append(literal, ":(literal)"+p)
+	}
+	gitOut(append([]string{"clean", "-f"}, cleanArgs(*dirs, *ignored, true, literal)...)...)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zncoder/check"
+)
+
+var codeOwnersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type ownerRule struct {
+	pattern string
+	re      *regexp.Regexp
+	owners  []string
+}
+
+type codeOwners []ownerRule
+
+func parseCodeOwners(b []byte) codeOwners {
+	var co codeOwners
+	for _, ln := range strings.Split(string(b), "\n") {
+		for i := 0; i < len(ln); i++ {
+			if ln[i] == '\\' {
+				i++
+			} else if ln[i] == '#' {
+				ln = ln[:i]
+			}
+		}
+		fs := strings.Fields(strings.ReplaceAll(ln, `\ `, "\x00"))
+		if len(fs) == 0 {
+			continue
+		}
+		pat := strings.ReplaceAll(strings.ReplaceAll(fs[0], "\x00", " "), `\#`, "#")
+		co = append(co, ownerRule{pattern: pat, re: globRegexp(pat), owners: fs[1:]})
+	}
+	return co
+}
+
+func (co codeOwners) owners(path string) []string {
+	for i := len(co) - 1; i >= 0; i-- {
+		if co[i].re.MatchString(path) {
+			return co[i].owners
+		}
+	}
+	return nil
+}
+
+func globRegexp(pat string) *regexp.Regexp {
+	dirOnly := strings.HasSuffix(pat, "/")
+	p := strings.Trim(pat, "/")
+	var sb strings.Builder
+	// a leading or middle slash anchors the pattern to the repo dir
+	if strings.HasPrefix(pat, "/") || strings.Contains(p, "/") {
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case strings.HasPrefix(p[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	switch {
+	case dirOnly:
+		sb.WriteString("/.*$")
+	case strings.HasSuffix(p, "/*") || p == "*" && strings.HasPrefix(pat, "/"):
+		sb.WriteString("$")
+	default:
+		sb.WriteString("(?:/.*)?$")
+	}
+	return regexp.MustCompile(sb.String())
+}
+
+func readCodeOwners() codeOwners {
+	for _, f := range codeOwnersFiles {
+		b, err := os.ReadFile(filepath.Join(RepoDir(), f))
+		if err == nil {
+			return parseCodeOwners(b)
+		}
+	}
+	return nil
+}
+
+func changedFiles(base string) []string {
+	s := sh("git diff --name-only %s...HEAD", base)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func codeReviewers(co codeOwners, files []string) []string {
+	var reviewers []string
+	me := Username()
+	for _, f := range files {
+		for _, o := range co.owners(f) {
+			// an owner by email cannot be requested for review
+			if !strings.HasPrefix(o, "@") {
+				continue
+			}
+			o = o[1:]
+			if o != me && !slices.Contains(reviewers, o) {
+				reviewers = append(reviewers, o)
+			}
+		}
+	}
+	return reviewers
+}
+
+func pathLabels(files []string) []string {
+	var labels []string
+	for _, rule := range configValues("mygit.label") {
+		pat, label, ok := strings.Cut(rule, "=")
+		check.T(ok && pat != "" && label != "").F("invalid label rule", "rule", rule)
+		re := globRegexp(strings.TrimSpace(pat))
+		label = strings.TrimSpace(label)
+		if slices.Contains(labels, label) {
+			continue
+		}
+		if slices.ContainsFunc(files, re.MatchString) {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
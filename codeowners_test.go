@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want string
+	}{
+		{"*.go", `^(?:.*/)?[^/]*\.go(?:/.*)?$`},
+		{"/build", `^build(?:/.*)?$`},
+		{"docs/", `^(?:.*/)?docs/.*$`},
+		{"/docs/", `^docs/.*$`},
+		{"api/v1", `^api/v1(?:/.*)?$`},
+		{"docs/*", `^docs/[^/]*$`},
+		{"/*", `^[^/]*$`},
+		{"**/logs", `^(?:.*/)?logs(?:/.*)?$`},
+		{"a/**/b", `^a/(?:.*/)?b(?:/.*)?$`},
+		{"lib/**", `^lib/.*(?:/.*)?$`},
+		{"file?.txt", `^(?:.*/)?file[^/]\.txt(?:/.*)?$`},
+	}
+	for _, tc := range tests {
+		if got := globRegexp(tc.pat).String(); got != tc.want {
+			t.Errorf("globRegexp(%q) = %s, want %s", tc.pat, got, tc.want)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pat   string
+		match []string
+		miss  []string
+	}{
+		{"*.go", []string{"a.go", "x/y/a.go"}, []string{"a.go.txt", "go"}},
+		{"/build", []string{"build", "build/out.o"}, []string{"src/build", "builder"}},
+		{"build", []string{"build", "src/build/x"}, []string{"builder"}},
+		{"docs/", []string{"docs/a.md", "x/docs/a.md"}, []string{"docs", "docsx/a.md"}},
+		{"/docs/", []string{"docs/a.md", "docs/x/a.md"}, []string{"x/docs/a.md"}},
+		{"api/v1", []string{"api/v1/a.go"}, []string{"x/api/v1/a.go"}},
+		{"docs/*", []string{"docs/a.md"}, []string{"docs/x/a.md"}},
+		{"/*", []string{"README"}, []string{"x/README"}},
+		{"**/logs", []string{"logs/a", "x/y/logs/a"}, []string{"xlogs/a"}},
+		{"a/**/b", []string{"a/b", "a/x/y/b", "a/x/b/c"}, []string{"x/a/b"}},
+	}
+	for _, tc := range tests {
+		re := globRegexp(tc.pat)
+		for _, p := range tc.match {
+			if !re.MatchString(p) {
+				t.Errorf("%q does not match %q", tc.pat, p)
+			}
+		}
+		for _, p := range tc.miss {
+			if re.MatchString(p) {
+				t.Errorf("%q matches %q", tc.pat, p)
+			}
+		}
+	}
+}
+
+func TestCodeOwners(t *testing.T) {
+	co := parseCodeOwners([]byte(`# comment line
+*       @org/all  # trailing comment
+
+*.go    @gopher
+/docs/  @writer a@example.com
+api/    @api
+api/generated/
+\#notes @hash # comment
+my\ dir/ @space
+`))
+	if n := len(co); n != 7 {
+		t.Fatalf("parsed %d rules, want 7", n)
+	}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"README", []string{"@org/all"}},
+		{"main.go", []string{"@gopher"}},
+		{"docs/a.md", []string{"@writer", "a@example.com"}},
+		{"x/docs/a.md", []string{"@org/all"}},
+		// last match wins
+		{"api/a.go", []string{"@api"}},
+		{"x/api/a.txt", []string{"@api"}},
+		// a rule without owners makes the file unowned
+		{"api/generated/a.go", nil},
+		{"#notes", []string{"@hash"}},
+		{"my dir/a", []string{"@space"}},
+	}
+	for _, tc := range tests {
+		if got := co.owners(tc.path); !slices.Equal(got, tc.want) {
+			t.Errorf("owners(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
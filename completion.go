@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+type flagSpec struct {
+	Name  string
+	Usage string
+	Value bool // the flag takes a value
+}
+
+type opSpec struct {
+	Alias    string
+	Desc     string
+	Flags    []flagSpec
+	Args     []string
+	Variadic bool
+}
+
+var opNameRe = regexp.MustCompile(`^([A-Z]+_)?([A-Z].*)$`)
+
+func describeOp(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+func argKind(alias, arg string) string {
+	a := strings.TrimSuffix(strings.Trim(arg, "[]"), "...")
+	switch {
+	case strings.Contains(a, "message"):
+		return ""
+	case a == "file" || a == "patch_file":
+		return "file"
+	case a == "remote_branch" || a == "release_branch_re" || alias == "sr" && a == "branch_re":
+		return "remote"
+	case a == "worktree_id":
+		if alias == "wd" {
+			return "worktree"
+		}
+		return ""
+	case a == "pr" || strings.HasSuffix(a, "_pr"):
+		return "pr"
+	case strings.Contains(a, "branch_re") && strings.Contains(a, "commit"):
+		return "branch_commit"
+	case strings.Contains(a, "branch_re"):
+		return "branch"
+	case strings.Contains(a, "commit"):
+		return "commit"
+	}
+	return ""
+}
+
+func parseUsage(alias, usage string) opSpec {
+	spec := opSpec{Alias: alias}
+	lns := strings.Split(usage, "\n")
+	for i, ln := range lns {
+		switch {
+		case strings.HasPrefix(ln, "Usage: "):
+			for _, arg := range strings.Fields(ln)[2:] {
+				if arg == "[...]" || strings.HasSuffix(arg, "...") || strings.HasSuffix(arg, "...]") {
+					spec.Variadic = true
+				}
+				if arg != "[...]" {
+					spec.Args = append(spec.Args, argKind(alias, arg))
+				}
+			}
+		case strings.HasPrefix(ln, "  -"):
+			name, desc, sameLine := strings.Cut(strings.TrimSpace(ln), "\t")
+			fs := strings.Fields(name)
+			f := flagSpec{Name: strings.TrimPrefix(fs[0], "-"), Value: len(fs) > 1}
+			if sameLine {
+				f.Usage = desc
+			} else if i+1 < len(lns) {
+				f.Usage = strings.TrimSpace(lns[i+1])
+			}
+			spec.Flags = append(spec.Flags, f)
+		}
+	}
+	return spec
+}
+
+func opSpecs() []opSpec {
+	exe := check.V(os.Executable()).F("executable")
+	var specs []opSpec
+	rt := reflect.TypeOf(OpList{})
+	for i := 0; i < rt.NumMethod(); i++ {
+		mo := opNameRe.FindStringSubmatch(rt.Method(i).Name)
+		if mo == nil {
+			continue
+		}
+		alias := strings.ToLower(mo[2])
+		if mo[1] != "" {
+			alias = strings.ToLower(strings.TrimSuffix(mo[1], "_"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		// -h prints the usage in mygo.ParseFlag before the op does anything
+		out, _ := exec.CommandContext(ctx, exe, alias, "-h").CombinedOutput()
+		cancel()
+		spec := parseUsage(alias, string(out))
+		spec.Desc = describeOp(mo[2])
+		specs = append(specs, spec)
+	}
+	specs = append(specs, opSpec{Alias: "help", Desc: "list ops"})
+	slices.SortFunc(specs, func(a, b opSpec) int { return strings.Compare(a.Alias, b.Alias) })
+	return specs
+}
+
+func completionList(kind string) {
+	switch kind {
+	case "branch":
+		for _, br := range matchLocalBranches(".", true, true) {
+			fmt.Println(br)
+		}
+	case "remote":
+		for _, br := range matchRemoteBranches(".", false, false) {
+			fmt.Println(br)
+		}
+	case "worktree":
+		for _, wt := range listWorktrees() {
+			if id, ok := strings.CutPrefix(filepath.Base(wt.Path), "wt-"); ok {
+				fmt.Println(id)
+			}
+		}
+	case "commit":
+		fmt.Println(shQ("git log -n 20 --format=%s", "%h%x09%s"))
+	case "branch_commit":
+		completionList("branch")
+		completionList("commit")
+	case "pr":
+		*offline = true
+		for br, cp := range loadPRCache().PRs {
+			if cp.State == "OPEN" {
+				fmt.Printf("%d\t%s\n", cp.Number, br)
+			}
+		}
+	}
+}
+
+func (OpList) OC_Completion() {
+	list := flag.String("list", "", "print the candidates of an arg kind for the completion scripts")
+	mygo.ParseFlag("[bash/zsh/fish]")
+	if *list != "" {
+		completionList(*list)
+		return
+	}
+
+	shell := flag.Arg(0)
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	// os.Args[0] is the op alias by now, and a symlinked alias resolves to the binary
+	prog := filepath.Base(check.V(os.Executable()).F("executable"))
+	specs := opSpecs()
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion(prog, specs))
+	case "zsh":
+		fmt.Print(zshCompletion(prog, specs))
+	case "fish":
+		fmt.Print(fishCompletion(prog, specs))
+	default:
+		check.F("unsupported shell", "shell", shell)
+	}
+}
+
+func argCases(specs []opSpec, kind string) []string {
+	var cs []string
+	for _, sp := range specs {
+		for i, k := range sp.Args {
+			if k != kind {
+				continue
+			}
+			if sp.Variadic && i == len(sp.Args)-1 {
+				cs = append(cs, sp.Alias+":*")
+			} else {
+				cs = append(cs, fmt.Sprintf("%s:%d", sp.Alias, i))
+			}
+		}
+	}
+	return cs
+}
+
+var argKinds = []string{"file", "branch", "remote", "worktree", "commit", "branch_commit", "pr"}
+
+func flagNames(sp opSpec, valueOnly bool) string {
+	var ss []string
+	for _, f := range sp.Flags {
+		if !valueOnly || f.Value {
+			ss = append(ss, "-"+f.Name)
+		}
+	}
+	return strings.Join(ss, " ")
+}
+
+func argKindFunc(sb *strings.Builder, fn string, specs []opSpec) {
+	fmt.Fprintf(sb, "%s() {\n  case \"$1:$2\" in\n", fn)
+	for _, kind := range argKinds {
+		if cs := argCases(specs, kind); len(cs) > 0 {
+			fmt.Fprintf(sb, "    %s) kind=%s ;;\n", strings.Join(cs, "|"), kind)
+		}
+	}
+	sb.WriteString("    *) kind= ;;\n  esac\n}\n\n")
+}
+
+func valueFlagsFunc(sb *strings.Builder, fn string, specs []opSpec) {
+	fmt.Fprintf(sb, "%s() {\n  case \"$1\" in\n", fn)
+	for _, sp := range specs {
+		if vf := flagNames(sp, true); vf != "" {
+			fmt.Fprintf(sb, "    %s) vflags=\"%s\" ;;\n", sp.Alias, vf)
+		}
+	}
+	sb.WriteString("    *) vflags= ;;\n  esac\n}\n\n")
+}
+
+func bashCompletion(prog string, specs []opSpec) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# bash completion for %s, generated by %s oc bash\n\n", prog, prog)
+	argKindFunc(&sb, "_mygit_arg_kind", specs)
+	valueFlagsFunc(&sb, "_mygit_value_flags", specs)
+
+	sb.WriteString("_mygit_flags() {\n  case \"$1\" in\n")
+	for _, sp := range specs {
+		if fl := flagNames(sp, false); fl != "" {
+			fmt.Fprintf(&sb, "    %s) flags=\"%s\" ;;\n", sp.Alias, fl)
+		}
+	}
+	sb.WriteString("    *) flags= ;;\n  esac\n}\n\n")
+
+	var aliases []string
+	for _, sp := range specs {
+		aliases = append(aliases, sp.Alias)
+	}
+	fmt.Fprintf(&sb, `_mygit() {
+  local cur=${COMP_WORDS[COMP_CWORD]}
+  COMPREPLY=()
+  if [[ $COMP_CWORD -eq 1 ]]; then
+    COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    return
+  fi
+  local op=${COMP_WORDS[1]} flags vflags kind n=0 i
+  if [[ $cur == -* ]]; then
+    _mygit_flags "$op"
+    COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    return
+  fi
+  _mygit_value_flags "$op"
+  [[ " $vflags " == *" ${COMP_WORDS[COMP_CWORD-1]} "* ]] && return
+  for ((i = 2; i < COMP_CWORD; i++)); do
+    if [[ ${COMP_WORDS[i]} == -* ]]; then
+      [[ " $vflags " == *" ${COMP_WORDS[i]} "* ]] && ((i++))
+    else
+      ((n++))
+    fi
+  done
+  _mygit_arg_kind "$op" "$n"
+  [[ -z $kind ]] && _mygit_arg_kind "$op" "*"
+  case $kind in
+    "") ;;
+    file) COMPREPLY=($(compgen -f -- "$cur")) ;;
+    *) COMPREPLY=($(compgen -W "$(%s oc -list "$kind" 2>/dev/null | cut -f1)" -- "$cur")) ;;
+  esac
+}
+
+complete -F _mygit %s
+`, strings.Join(aliases, " "), prog, prog)
+	return sb.String()
+}
+
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func zshCompletion(prog string, specs []opSpec) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#compdef %s\n# zsh completion for %s, generated by %s oc zsh\n\n", prog, prog, prog)
+	argKindFunc(&sb, "_mygit_arg_kind", specs)
+	valueFlagsFunc(&sb, "_mygit_value_flags", specs)
+
+	sb.WriteString("_mygit_flags() {\n  case \"$1\" in\n")
+	for _, sp := range specs {
+		if len(sp.Flags) == 0 {
+			continue
+		}
+		var fs []string
+		for _, f := range sp.Flags {
+			fs = append(fs, zshQuote(fmt.Sprintf("-%s:%s", f.Name, f.Usage)))
+		}
+		fmt.Fprintf(&sb, "    %s) flags=(%s) ;;\n", sp.Alias, strings.Join(fs, " "))
+	}
+	sb.WriteString("    *) flags=() ;;\n  esac\n}\n\n")
+
+	var ops []string
+	for _, sp := range specs {
+		ops = append(ops, zshQuote(sp.Alias+":"+sp.Desc))
+	}
+	fmt.Fprintf(&sb, `_mygit() {
+  if (( CURRENT == 2 )); then
+    local -a ops
+    ops=(%s)
+    _describe op ops
+    return
+  fi
+  local op=$words[2] kind vflags n=0 i
+  local -a flags vals
+  if [[ $words[CURRENT] == -* ]]; then
+    _mygit_flags $op
+    _describe flag flags
+    return
+  fi
+  _mygit_value_flags $op
+  [[ " $vflags " == *" $words[CURRENT-1] "* ]] && return
+  for ((i = 3; i < CURRENT; i++)); do
+    if [[ $words[i] == -* ]]; then
+      [[ " $vflags " == *" $words[i] "* ]] && ((i++))
+    else
+      ((n++))
+    fi
+  done
+  _mygit_arg_kind $op $n
+  [[ -z $kind ]] && _mygit_arg_kind $op "*"
+  case $kind in
+    "") ;;
+    file) _files ;;
+    *)
+      vals=(${(f)"$(%s oc -list $kind 2>/dev/null | sed -e 's/:/\\:/g' -e 's/\t/:/')"})
+      _describe $kind vals
+      ;;
+  esac
+}
+
+compdef _mygit %s
+`, strings.Join(ops, " "), prog, prog)
+	return sb.String()
+}
+
+func fishCompletion(prog string, specs []opSpec) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# fish completion for %s, generated by %s oc fish\n\n", prog, prog)
+	fmt.Fprintf(&sb, `function __mygit_arg_kind
+  set -l words (commandline -opc)
+  set -l op $words[2]
+  set -l vflags (string split ' ' -- $argv[2])
+  set -l n 0
+  set -l skip 0
+  for w in $words[3..-1]
+    if test $skip = 1
+      set skip 0
+    else if string match -q -- '-*' $w
+      contains -- $w $vflags; and set skip 1
+    else
+      set n (math $n + 1)
+    end
+  end
+  contains -- "$op:$n" $argv[3..-1]; or contains -- "$op:*" $argv[3..-1]
+end
+
+complete -c %s -f
+`, prog)
+
+	for _, sp := range specs {
+		fmt.Fprintf(&sb, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", prog, sp.Alias, zshQuote(sp.Desc))
+	}
+	sb.WriteString("\n")
+	for _, sp := range specs {
+		for _, f := range sp.Flags {
+			fmt.Fprintf(&sb, "complete -c %s -n '__fish_seen_subcommand_from %s' -o %s -d %s\n", prog, sp.Alias, f.Name, zshQuote(f.Usage))
+		}
+	}
+	sb.WriteString("\n")
+	for _, kind := range argKinds {
+		cs := argCases(specs, kind)
+		if len(cs) == 0 {
+			continue
+		}
+		var ops []string
+		for _, c := range cs {
+			ops = append(ops, strings.Split(c, ":")[0])
+		}
+		slices.Sort(ops)
+		for _, op := range slices.Compact(ops) {
+			var vf string
+			for _, sp := range specs {
+				if sp.Alias == op {
+					vf = flagNames(sp, true)
+				}
+			}
+			var opCases []string
+			for _, c := range cs {
+				if strings.HasPrefix(c, op+":") {
+					opCases = append(opCases, c)
+				}
+			}
+			cond := fmt.Sprintf("__fish_seen_subcommand_from %s; and __mygit_arg_kind %s '%s' %s", op, op, vf, strings.Join(opCases, " "))
+			args := fmt.Sprintf("(%s oc -list %s 2>/dev/null)", prog, kind)
+			if kind == "file" {
+				args = "(__fish_complete_path (commandline -ct))"
+			}
+			fmt.Fprintf(&sb, "complete -c %s -n %s -a %s\n", prog, zshQuote(cond), zshQuote(args))
+		}
+	}
+	return sb.String()
+}
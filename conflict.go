@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+var theirsHeads = map[string]string{
+	"rebase":      "REBASE_HEAD",
+	"cherry-pick": "CHERRY_PICK_HEAD",
+	"revert":      "REVERT_HEAD",
+	"merge":       "MERGE_HEAD",
+}
+
+func inProgressOp() string {
+	gd := GitDir()
+	exist := func(name string) bool { return mygo.FileExist(filepath.Join(gd, name)) }
+	switch {
+	case exist("rebase-apply/applying"):
+		return "am"
+	case exist("rebase-merge"), exist("rebase-apply"):
+		return "rebase"
+	case exist("CHERRY_PICK_HEAD"):
+		return "cherry-pick"
+	case exist("REVERT_HEAD"):
+		return "revert"
+	case exist("MERGE_HEAD"):
+		return "merge"
+	}
+	return ""
+}
+
+func currentOp(want string) string {
+	op := inProgressOp()
+	check.T(op != "").F("no rebase, cherry-pick, merge or revert in progress")
+	check.T(want == "" || op == want).F("another command in progress", "in_progress", op, "want", want)
+	return op
+}
+
+func diffFiles(args ...string) []string {
+	s := strings.TrimRight(gitOut(append([]string{"diff", "--name-only", "-z"}, args...)...), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
+
+func conflictFiles() []string {
+	return diffFiles("--diff-filter=U")
+}
+
+var conflictMarkers = []string{"<<<<<<< ", "||||||| ", ">>>>>>> "}
+
+func hasConflictMarkers(filename string) bool {
+	f, err := os.Open(filepath.Join(RepoDir(), filename))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<24)
+	for sc.Scan() {
+		ln := sc.Text()
+		for _, m := range conflictMarkers {
+			if strings.HasPrefix(ln, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func markedFiles() []string {
+	files := append(conflictFiles(), diffFiles("HEAD")...)
+	slices.Sort(files)
+	var marked []string
+	for _, f := range slices.Compact(files) {
+		if hasConflictMarkers(f) {
+			marked = append(marked, f)
+		}
+	}
+	return marked
+}
+
+func showConflicts(op string) {
+	fmt.Printf("%s in progress\n", op)
+	fmt.Printf("  ours:   %s\n", sh("git log -1 --format='%%h %%s' %s", "HEAD"))
+	if h := theirsHeads[op]; h != "" && mygo.FileExist(filepath.Join(GitDir(), h)) {
+		fmt.Printf("  theirs: %s\n", sh("git log -1 --format='%%h %%s' %s", h))
+	}
+	marked := markedFiles()
+	for _, f := range conflictFiles() {
+		if hasConflictMarkers(f) {
+			fmt.Printf("  U %s\n", f)
+		} else {
+			fmt.Printf("  R %s (resolved, not staged)\n", f)
+		}
+		marked = slices.DeleteFunc(marked, func(s string) bool { return s == f })
+	}
+	for _, f := range marked {
+		fmt.Printf("  M %s (conflict markers)\n", f)
+	}
+}
+
+func runMergeTool(files []string) {
+	for _, f := range files {
+		args := []string{"-C", RepoDir(), "mergetool", "--no-prompt"}
+		if env := os.Getenv("MYGIT_MERGETOOL"); env != "" {
+			args = append(args, "-t", env)
+		}
+		mygo.NewCmd("git", append(args, "--", f)...).Interactive()
+	}
+}
+
+func resumeOp(op, arg string) {
+	enableRerere()
+	signCommits()
+	used := rerereUsage()
+	c := mygo.NewCmd("git", op, arg)
+	c.C.Stdin = os.Stdin
+	code := c.RunWithExitCode()
+	showReplayed(used)
+	if code != 0 && inProgressOp() != "" {
+		showConflicts(op)
+		check.F("stopped by conflicts", "op", op)
+	}
+}
+
+func continueOp(want string, force, mergetool bool) {
+	op := currentOp(want)
+	if mergetool {
+		runMergeTool(conflictFiles())
+	}
+	if marked := markedFiles(); len(marked) > 0 && !force {
+		showConflicts(op)
+		check.F("conflict markers remain", "files", marked)
+	}
+	if files := conflictFiles(); len(files) > 0 {
+		gitOut(append([]string{"-C", RepoDir(), "add", "--"}, files...)...)
+	}
+	resumeOp(op, "--continue")
+}
+
+func abortOp(want string) {
+	op := currentOp(want)
+	sh("git %s --abort", op)
+}
+
+func (OpList) XL_ListConflicts() {
+	mygo.ParseFlag()
+	showConflicts(currentOp(""))
+}
+
+func (OpList) XC_Continue() {
+	force := flag.Bool("f", false, "continue even if conflict markers remain")
+	mergetool := flag.Bool("m", false, "run mergetool on conflicted files first")
+	mygo.ParseFlag()
+	continueOp("", *force, *mergetool)
+}
+
+func (OpList) XA_Abort() {
+	mygo.ParseFlag()
+	abortOp("")
+}
+
+func (OpList) XS_Skip() {
+	mygo.ParseFlag()
+	op := currentOp("")
+	check.T(op != "merge").F("cannot skip merge")
+	resumeOp(op, "--skip")
+}
+
+func (OpList) XT_MergeTool() {
+	mygo.ParseFlag("[file...]")
+	currentOp("")
+	files := conflictFiles()
+	if flag.NArg() > 0 {
+		files = nil
+		for _, f := range flag.Args() {
+			files = append(files, repoPath(f))
+		}
+	}
+	check.T(len(files) > 0).F("no conflicted file")
+	runMergeTool(files)
+}
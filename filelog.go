@@ -0,0 +1,240 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+type historyEntry struct {
+	commitInfo
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+}
+
+func fileHistory(rev, filename string, n int) []historyEntry {
+	s := gitOut("-C", RepoDir(), "log", "--follow", "--numstat", "-n", strconv.Itoa(n),
+		"--format=%x1e"+strings.TrimSuffix(commitInfoFormat, "%x1e"), rev, "--", filename)
+	hes := []historyEntry{}
+	for _, rec := range strings.Split(s, "\x1e") {
+		hdr, stat, _ := strings.Cut(strings.TrimSpace(rec), "\n")
+		fs := strings.Split(hdr, "\x00")
+		if len(fs) != 6 {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339, fs[4])
+		he := historyEntry{commitInfo: commitInfo{Hash: fs[0], Short: fs[1], Author: fs[2], Email: fs[3], Date: t, Subject: fs[5]}}
+		for _, ln := range strings.Split(strings.TrimSpace(stat), "\n") {
+			ss := strings.SplitN(ln, "\t", 3)
+			if len(ss) == 3 {
+				he.Added, _ = strconv.Atoi(ss[0])
+				he.Deleted, _ = strconv.Atoi(ss[1])
+				he.Path = ss[2]
+			}
+		}
+		hes = append(hes, he)
+	}
+	return hes
+}
+
+func revArg(i int) string {
+	if flag.NArg() > i {
+		return resolveRev(flag.Arg(i))
+	}
+	return "HEAD"
+}
+
+func colorFlag() string {
+	if useColor() {
+		return "--color=always"
+	}
+	return "--color=never"
+}
+
+func (OpList) FH_History() {
+	n := flag.Int("n", 20, "number of commits")
+	mygo.ParseFlag("file", "[branch_re_or_commit]")
+	filename := repoPath(flag.Arg(0))
+	rev := revArg(1)
+
+	if *jsonOut {
+		printJSON(fileHistory(rev, filename, *n))
+		return
+	}
+	format := "--format=%C(yellow)%h%C(reset) %ad %C(green)%an%C(reset)%n    %s"
+	fmt.Println(gitOut("-C", RepoDir(), "log", "--follow", "--stat", "-n", strconv.Itoa(*n), colorFlag(), format, "--date=short", rev, "--", filename))
+}
+
+type blameLine struct {
+	Line    int       `json:"line"`
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	PR      int       `json:"pr"`
+	Text    string    `json:"text"`
+}
+
+var (
+	lineRangeRe    = regexp.MustCompile(`^(.+):([0-9]+)(?:[-,](\+?[0-9]+))?$`)
+	blameHeaderRe  = regexp.MustCompile(`^([0-9a-f]{40}) [0-9]+ ([0-9]+)`)
+	uncommittedSHA = strings.Repeat("0", 40)
+)
+
+func parseLineRange(arg string) (string, string) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, ""
+	}
+	mo := lineRangeRe.FindStringSubmatch(arg)
+	if mo == nil {
+		return arg, ""
+	}
+	end := mo[3]
+	if end == "" {
+		end = mo[2]
+	}
+	return mo[1], fmt.Sprintf("%s,%s", mo[2], end)
+}
+
+func blame(rev, filename, lineRange string) []blameLine {
+	args := []string{"-C", RepoDir(), "blame", "--porcelain"}
+	if lineRange != "" {
+		args = append(args, "-L", lineRange)
+	}
+	args = append(args, rev, "--", filename)
+	if *verbose {
+		log.Println("git", strings.Join(args, " "))
+	}
+	// not gitOut, which trims the tab of a trailing empty line
+	s := string(mygo.NewCmd("git", args...).Silent(!*verbose).Stdout())
+
+	type commit struct {
+		author, subject string
+		date            time.Time
+	}
+	commits := make(map[string]*commit)
+	var bls []blameLine
+	var cur blameLine
+	var cm *commit
+	for _, ln := range strings.Split(s, "\n") {
+		if text, ok := strings.CutPrefix(ln, "\t"); ok {
+			cur.Author, cur.Date, cur.Subject = cm.author, cm.date, cm.subject
+			if pr := prInTitleRe.FindString(cm.subject); pr != "" {
+				cur.PR, _ = strconv.Atoi(strings.Trim(pr, "(#)"))
+			}
+			cur.Text = text
+			bls = append(bls, cur)
+			continue
+		}
+		if mo := blameHeaderRe.FindStringSubmatch(ln); mo != nil {
+			cur = blameLine{Hash: mo[1]}
+			cur.Line, _ = strconv.Atoi(mo[2])
+			if cm = commits[mo[1]]; cm == nil {
+				cm = &commit{}
+				commits[mo[1]] = cm
+			}
+			continue
+		}
+		key, val, _ := strings.Cut(ln, " ")
+		switch key {
+		case "author":
+			cm.author = val
+		case "author-time":
+			t, _ := strconv.ParseInt(val, 10, 64)
+			cm.date = time.Unix(t, 0)
+		case "summary":
+			cm.subject = val
+		}
+	}
+	return bls
+}
+
+func ageColor(t time.Time) string {
+	switch d := time.Since(t); {
+	case d < 7*24*time.Hour:
+		return colorGreen
+	case d < 90*24*time.Hour:
+		return colorYellow
+	case d < 365*24*time.Hour:
+		return ""
+	}
+	return colorDim
+}
+
+func (OpList) FB_Blame() {
+	mygo.ParseFlag("file[:line-range]", "[branch_re_or_commit]")
+	filename, lineRange := parseLineRange(flag.Arg(0))
+	filename = repoPath(filename)
+	bls := blame(revArg(1), filename, lineRange)
+	if *jsonOut {
+		if bls == nil {
+			bls = []blameLine{}
+		}
+		printJSON(bls)
+		return
+	}
+
+	color := useColor()
+	for _, bl := range bls {
+		short, author, pr := bl.Hash[:8], bl.Author, ""
+		if bl.Hash == uncommittedSHA {
+			short, author = "        ", "uncommitted"
+		}
+		if bl.PR > 0 {
+			pr = fmt.Sprintf("#%d", bl.PR)
+		}
+		if len(author) > 12 {
+			author = author[:12]
+		}
+		meta := fmt.Sprintf("%s %-6s %-12s %4s", short, pr, author, age(bl.Date))
+		if c := ageColor(bl.Date); color && c != "" {
+			meta = c + meta + colorReset
+		}
+		fmt.Printf("%s %5d| %s\n", meta, bl.Line, bl.Text)
+	}
+}
+
+func (OpList) FS_Search() {
+	regex := flag.Bool("g", false, "regex matching the added or removed lines (git log -G)")
+	pickaxeRegex := flag.Bool("e", false, "regex changing the number of occurrences (git log -S --pickaxe-regex)")
+	path := flag.String("f", "", "limit to the path")
+	all := flag.Bool("a", false, "search all branches")
+	mygo.ParseFlag("string_or_regex", "[branch_re_or_commit]")
+	check.T(flag.NArg() > 0).F("missing string_or_regex")
+
+	pat := flag.Arg(0)
+	var args []string
+	switch {
+	case *regex:
+		args = []string{"-G" + pat}
+	case *pickaxeRegex:
+		args = []string{"-S" + pat, "--pickaxe-regex"}
+	default:
+		args = []string{"-S" + pat}
+	}
+	if *all {
+		args = append(args, "--all")
+	} else {
+		args = append(args, revArg(1))
+	}
+	args = append(args, "--")
+	if *path != "" {
+		args = append(args, *path)
+	}
+
+	if *jsonOut {
+		printJSON(logCommits(args...))
+		return
+	}
+	format := "--format=%C(yellow)%h%C(reset) %ad %C(green)%an%C(reset) %s"
+	fmt.Println(gitOut(append([]string{"log", "--name-status", colorFlag(), format, "--date=short"}, args...)...))
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+func gh(args ...string) []byte {
+	if *verbose {
+		log.Println("gh", strings.Join(args, " "))
+	}
+	// run directly to keep titles and queries intact
+	return mygo.NewCmd("gh", args...).Silent(!*verbose).Stdout()
+}
+
+func prArg() string {
+	if flag.NArg() == 0 {
+		return ""
+	}
+	br := flag.Arg(0)
+	lbrs := matchLocalBranches(br, true, false)
+	if len(lbrs) == 1 {
+		br = lbrs[0]
+	}
+	return br
+}
+
+type prReview struct {
+	Author      struct{ Login string }
+	State       string
+	SubmittedAt time.Time
+}
+
+type prView struct {
+	Number           int
+	Title            string
+	URL              string
+	State            string
+	HeadRefName      string
+	HeadRefOid       string
+	BaseRefName      string
+	ReviewDecision   string
+	Mergeable        string
+	MergeStateStatus string
+	Reviews          []prReview
+}
+
+func viewPR(pr string) prView {
+	var pv prView
+	s := sh("gh pr view %s --json number,title,url,state,headRefName,headRefOid,baseRefName,reviewDecision,mergeable,mergeStateStatus,reviews", pr)
+	check.E(json.Unmarshal([]byte(s), &pv)).F("parse pr", "pr", pr)
+	return pv
+}
+
+func (pv prView) reviewers() ([]string, map[string]string) {
+	var names []string
+	states := make(map[string]string)
+	for _, r := range pv.Reviews {
+		name := r.Author.Login
+		old, ok := states[name]
+		if !ok {
+			names = append(names, name)
+		}
+		// a comment does not override an earlier decision
+		if r.State != "COMMENTED" || old == "" {
+			states[name] = r.State
+		}
+	}
+	return names, states
+}
+
+type prCheck struct {
+	Name     string
+	Workflow string
+	State    string
+	Bucket   string
+	Link     string
+}
+
+func prChecks(pr string) []prCheck {
+	// gh exits non-zero when a check fails or is pending
+	s := shQ("gh pr checks %s --json name,workflow,state,bucket,link", pr)
+	var checks []prCheck
+	if s != "" {
+		check.E(json.Unmarshal([]byte(s), &checks)).F("parse pr checks", "pr", pr)
+	}
+	return checks
+}
+
+func countChecks(checks []prCheck, buckets ...string) int {
+	n := 0
+	for _, c := range checks {
+		for _, b := range buckets {
+			if c.Bucket == b {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+type reviewThread struct {
+	IsResolved   bool
+	IsOutdated   bool
+	Path         string
+	Line         int
+	OriginalLine int
+	Comments     struct {
+		Nodes []struct {
+			Author struct{ Login string }
+			Body   string
+			URL    string
+		}
+	}
+}
+
+const reviewThreadsQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100) {
+        nodes {
+          isResolved isOutdated path line originalLine
+          comments(first: 1) { nodes { author { login } body url } }
+        }
+      }
+    }
+  }
+}`
+
+func unresolvedThreads(number int) []reviewThread {
+	var resp struct {
+		Data struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct{ Nodes []reviewThread }
+				}
+			}
+		}
+	}
+	b := gh("api", "graphql", "-F", "owner={owner}", "-F", "name={repo}",
+		"-F", fmt.Sprintf("number=%d", number), "-f", "query="+reviewThreadsQuery)
+	check.E(json.Unmarshal(b, &resp)).F("parse review threads", "pr", number)
+
+	var threads []reviewThread
+	for _, t := range resp.Data.Repository.PullRequest.ReviewThreads.Nodes {
+		if !t.IsResolved {
+			threads = append(threads, t)
+		}
+	}
+	return threads
+}
+
+func prLabels(numbers []int) map[int][]string {
+	labels := make(map[int][]string)
+	if len(numbers) == 0 {
+		return labels
+	}
+	var sb strings.Builder
+	sb.WriteString("query($owner: String!, $name: String!) {\n  repository(owner: $owner, name: $name) {\n")
+	for _, n := range numbers {
+		fmt.Fprintf(&sb, "    pr%d: issueOrPullRequest(number: %d) { ... on PullRequest { labels(first: 20) { nodes { name } } } }\n", n, n)
+	}
+	sb.WriteString("  }\n}")
+
+	var resp struct {
+		Data struct {
+			Repository map[string]*struct {
+				Labels struct{ Nodes []struct{ Name string } }
+			}
+		}
+	}
+	args := []string{"api", "graphql", "-F", "owner={owner}", "-F", "name={repo}", "-f", "query=" + sb.String()}
+	if *verbose {
+		log.Println("gh", strings.Join(args, " "))
+	}
+	// a missing number fails the query with the data of the others
+	b := mygo.NewCmd("gh", args...).Silent(!*verbose).IgnoreErr(true).Stdout()
+	check.E(json.Unmarshal(b, &resp)).F("parse pr labels")
+	for k, v := range resp.Data.Repository {
+		n, err := strconv.Atoi(strings.TrimPrefix(k, "pr"))
+		if err != nil || v == nil {
+			continue
+		}
+		for _, l := range v.Labels.Nodes {
+			labels[n] = append(labels[n], l.Name)
+		}
+	}
+	return labels
+}
+
+var hunkRe = regexp.MustCompile(`(?m)^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func localLine(cm, filename string, ln int) int {
+	// the path comes from github, so it never goes through the shell
+	s := string(mygo.NewCmd("git", "diff", "-U0", cm, "--", filename).Silent(!*verbose).IgnoreErr(true).Stdout())
+	atoi := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	off := 0
+	for _, m := range hunkRe.FindAllStringSubmatch(s, -1) {
+		a, b, c, d := atoi(m[1]), atoi(m[2]), atoi(m[3]), atoi(m[4])
+		if ln < a || (b == 0 && ln == a) {
+			break
+		}
+		// a line in a changed hunk maps to the beginning of the hunk
+		if b > 0 && ln < a+b {
+			return max(c, 1)
+		}
+		off += d - b
+	}
+	return ln + off
+}
+
+func localAnchor(t reviewThread, headOid string) string {
+	ln := t.Line
+	if ln == 0 {
+		ln = t.OriginalLine
+	}
+	if ln > 0 && shQ("git cat-file -t %s", headOid) == "commit" {
+		ln = localLine(headOid, t.Path, ln)
+	}
+	path := filepath.Join(RepoDir(), t.Path)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			path = rel
+		}
+	}
+	return fmt.Sprintf("%s:%d", path, ln)
+}
+
+func showReview(pv prView, checks []prCheck) {
+	fmt.Printf("#%d %s\n%s\n", pv.Number, pv.Title, pv.URL)
+	fmt.Printf("state:%s mergeable:%s (%s) review:%s\n", pv.State, pv.Mergeable, pv.MergeStateStatus, pv.ReviewDecision)
+
+	fmt.Printf("checks: %d pass, %d fail, %d pending\n",
+		countChecks(checks, "pass"), countChecks(checks, "fail", "cancel"), countChecks(checks, "pending"))
+	for _, c := range checks {
+		name := c.Name
+		if c.Workflow != "" {
+			name = c.Workflow + "/" + c.Name
+		}
+		fmt.Printf("  %-8s %s  %s\n", c.Bucket, name, c.Link)
+	}
+
+	names, states := pv.reviewers()
+	fmt.Println("reviews:")
+	for _, name := range names {
+		fmt.Printf("  %-18s %s\n", states[name], name)
+	}
+
+	if pv.HeadRefOid != "" && shQ("git cat-file -t %s", pv.HeadRefOid) != "commit" {
+		shQ("git fetch origin %s", pv.HeadRefName)
+	}
+	threads := unresolvedThreads(pv.Number)
+	fmt.Printf("unresolved threads: %d\n", len(threads))
+	for _, t := range threads {
+		var author, body, url string
+		if cs := t.Comments.Nodes; len(cs) > 0 {
+			author, url = cs[0].Author.Login, cs[0].URL
+			body, _, _ = strings.Cut(strings.TrimSpace(cs[0].Body), "\n")
+		}
+		outdated := ""
+		if t.IsOutdated {
+			outdated = " (outdated)"
+		}
+		fmt.Printf("  %s%s\n    %s: %s\n    %s\n", localAnchor(t, pv.HeadRefOid), outdated, author, body, url)
+	}
+}
+
+func (OpList) GR_GithubReview() {
+	watch := flag.Bool("watch", false, "wait for checks to finish and fail if any check fails")
+	interval := flag.Duration("i", 30*time.Second, "poll interval of watch")
+	mygo.ParseFlag("[branch_re_or_pr]")
+	pr := prArg()
+
+	checks := prChecks(pr)
+	// gh reports no checks on a pr without ci, which is neither pending nor passed
+	check.T(!*watch || len(checks) > 0).F("no checks reported", "pr", pr)
+	for *watch && countChecks(checks, "pending") > 0 {
+		log.Printf("%d of %d checks pending", countChecks(checks, "pending"), len(checks))
+		time.Sleep(*interval)
+		checks = prChecks(pr)
+	}
+	showReview(viewPR(pr), checks)
+	if *watch {
+		check.T(countChecks(checks, "fail", "cancel") == 0).F("checks failed")
+	}
+}
+
+func (pv prView) approved() bool {
+	if pv.ReviewDecision != "" {
+		return pv.ReviewDecision == "APPROVED"
+	}
+	_, states := pv.reviewers()
+	ok := false
+	for _, st := range states {
+		switch st {
+		case "APPROVED":
+			ok = true
+		case "CHANGES_REQUESTED":
+			return false
+		}
+	}
+	return ok
+}
+
+func retargetChildPRs(pv prView) {
+	var prs []struct {
+		Number      int
+		HeadRefName string
+		BaseRefName string
+	}
+	s := sh("gh pr list --author @me --json number,headRefName,baseRefName")
+	check.E(json.Unmarshal([]byte(s), &prs)).F("parse pr list")
+
+	fetched := false
+	for _, c := range prs {
+		if c.BaseRefName != c.HeadRefName+tmpSuffix {
+			continue
+		}
+		if !fetched && shQ("git cat-file -t %s", pv.HeadRefOid) != "commit" {
+			shQ("git fetch origin refs/pull/%d/head", pv.Number)
+			fetched = true
+		}
+		shQ("git fetch origin %s", c.BaseRefName)
+		if shQ("git cat-file -t %s", pv.HeadRefOid) != "commit" {
+			log.Printf("skip retargeting #%d:%s, head %s of #%d is not found", c.Number, c.HeadRefName, pv.HeadRefOid, pv.Number)
+			continue
+		}
+		if !isAncestor("origin/"+c.BaseRefName, pv.HeadRefOid) {
+			continue
+		}
+		log.Printf("retarget #%d:%s to %s", c.Number, c.HeadRefName, pv.BaseRefName)
+		sh("gh pr edit %d -B %s", c.Number, pv.BaseRefName)
+		invalidatePRCache()
+		sh("git push origin :%s", c.BaseRefName)
+		log.Printf("#%d:%s still has the merged commits, run rb on %s to rebase it onto %s", c.Number, c.HeadRefName, c.HeadRefName, pv.BaseRefName)
+	}
+}
+
+func (OpList) GM_GithubMerge() {
+	force := flag.Bool("f", false, "merge without approval")
+	method := flag.String("m", "", "merge method: squash, rebase or merge (default mygit.mergeMethod or squash)")
+	mygo.ParseFlag("[branch_re_or_pr]")
+	pr := prArg()
+
+	pv := viewPR(pr)
+	check.T(pv.State == "OPEN").F("pr is not open", "pr", pv.Number, "state", pv.State)
+	check.T(pv.Mergeable != "CONFLICTING").F("pr has conflicts", "pr", pv.Number)
+	check.T(*force || pv.approved()).F("pr is not approved", "pr", pv.Number, "review", pv.ReviewDecision)
+	checks := prChecks(pr)
+	check.T(countChecks(checks, "fail", "cancel") == 0).F("checks failed", "pr", pv.Number)
+
+	m := *method
+	if m == "" {
+		m = gitConfig("mergeMethod", "squash")
+	}
+	check.T(m == "squash" || m == "rebase" || m == "merge").F("invalid merge method", "method", m)
+
+	if n := countChecks(checks, "pending"); n > 0 {
+		log.Printf("enable auto-merge of #%d by %s, %d checks pending", pv.Number, m, n)
+		sh("gh pr merge %d --auto --%s", pv.Number, m)
+		invalidatePRCache()
+		return
+	}
+	log.Printf("merge #%d by %s", pv.Number, m)
+	sh("gh pr merge %d --%s", pv.Number, m)
+	invalidatePRCache()
+
+	retargetChildPRs(pv)
+	if len(matchLocalBranches("^"+regexp.QuoteMeta(pv.HeadRefName)+"$", true, true)) > 0 {
+		cleanupBranch(pv.HeadRefName, "MERGED")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+)
+
+// the json field names are stable, and absent values are zero values or [] rather than null
+
+var jsonOut = flag.Bool("json", false, "print json")
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	check.E(enc.Encode(v)).F("encode json")
+}
+
+type commitInfo struct {
+	Hash    string    `json:"hash"`
+	Short   string    `json:"short"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+const commitInfoFormat = "%H%x00%h%x00%an%x00%ae%x00%cI%x00%s%x1e"
+
+func listCommits(args string) []commitInfo {
+	return parseCommits(sh("git log --format=%s %s", commitInfoFormat, args))
+}
+
+func logCommits(args ...string) []commitInfo {
+	return parseCommits(gitOut(append([]string{"log", "--format=" + commitInfoFormat}, args...)...))
+}
+
+func parseCommits(s string) []commitInfo {
+	cms := []commitInfo{}
+	for _, rec := range strings.Split(s, "\x1e") {
+		fs := strings.Split(strings.TrimSpace(rec), "\x00")
+		if len(fs) != 6 {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339, fs[4])
+		cms = append(cms, commitInfo{Hash: fs[0], Short: fs[1], Author: fs[2], Email: fs[3], Date: t, Subject: fs[5]})
+	}
+	return cms
+}
+
+type commitDetail struct {
+	commitInfo
+	Body  string   `json:"body"`
+	Files []string `json:"files"`
+}
+
+type statusEntry struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"orig_path"`
+	Kind     string `json:"kind"`
+	Index    string `json:"index"`
+	Worktree string `json:"worktree"`
+}
+
+type statusInfo struct {
+	Branch   string        `json:"branch"`
+	Commit   string        `json:"commit"`
+	Upstream string        `json:"upstream"`
+	Ahead    int           `json:"ahead"`
+	Behind   int           `json:"behind"`
+	Entries  []statusEntry `json:"entries"`
+	Branches []branchInfo  `json:"branches"`
+}
+
+func worktreeStatus(untracked bool) statusInfo {
+	uarg := "-uno"
+	if untracked {
+		uarg = "-unormal"
+	}
+	s := sh("git status --porcelain=v2 -b -z %s", uarg)
+	st := statusInfo{Entries: []statusEntry{}, Branches: []branchInfo{}}
+	recs := strings.Split(s, "\x00")
+	for i := 0; i < len(recs); i++ {
+		rec := recs[i]
+		switch {
+		case strings.HasPrefix(rec, "# branch.oid "):
+			st.Commit = strings.TrimPrefix(rec, "# branch.oid ")
+		case strings.HasPrefix(rec, "# branch.head "):
+			st.Branch = strings.TrimPrefix(rec, "# branch.head ")
+		case strings.HasPrefix(rec, "# branch.upstream "):
+			st.Upstream = strings.TrimPrefix(rec, "# branch.upstream ")
+		case strings.HasPrefix(rec, "# branch.ab "):
+			fs := strings.Fields(rec)
+			st.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fs[2], "+"))
+			st.Behind, _ = strconv.Atoi(strings.TrimPrefix(fs[3], "-"))
+		case strings.HasPrefix(rec, "1 "), strings.HasPrefix(rec, "u "):
+			n := 9
+			kind := "changed"
+			if rec[0] == 'u' {
+				n, kind = 11, "unmerged"
+			}
+			fs := strings.SplitN(rec, " ", n)
+			st.Entries = append(st.Entries, statusEntry{Path: fs[n-1], Kind: kind, Index: fs[1][:1], Worktree: fs[1][1:]})
+		case strings.HasPrefix(rec, "2 "):
+			fs := strings.SplitN(rec, " ", 10)
+			i++
+			st.Entries = append(st.Entries, statusEntry{Path: fs[9], OrigPath: recs[i], Kind: "renamed", Index: fs[1][:1], Worktree: fs[1][1:]})
+		case strings.HasPrefix(rec, "? "):
+			st.Entries = append(st.Entries, statusEntry{Path: rec[2:], Kind: "untracked", Index: "?", Worktree: "?"})
+		case strings.HasPrefix(rec, "! "):
+			st.Entries = append(st.Entries, statusEntry{Path: rec[2:], Kind: "ignored", Index: "!", Worktree: "!"})
+		}
+	}
+	return st
+}
+
+type worktreeInfo struct {
+	Path     string `json:"path"`
+	Head     string `json:"head"`
+	Branch   string `json:"branch"`
+	Bare     bool   `json:"bare"`
+	Detached bool   `json:"detached"`
+	Locked   bool   `json:"locked"`
+	Prunable bool   `json:"prunable"`
+}
+
+func listWorktrees() []worktreeInfo {
+	wts := []worktreeInfo{}
+	for _, blk := range strings.Split(sh("git worktree list --porcelain"), "\n\n") {
+		var wt worktreeInfo
+		for _, ln := range strings.Split(blk, "\n") {
+			k, v, _ := strings.Cut(ln, " ")
+			switch k {
+			case "worktree":
+				wt.Path = v
+			case "HEAD":
+				wt.Head = v
+			case "branch":
+				wt.Branch = strings.TrimPrefix(v, "refs/heads/")
+			case "bare":
+				wt.Bare = true
+			case "detached":
+				wt.Detached = true
+			case "locked":
+				wt.Locked = true
+			case "prunable":
+				wt.Prunable = true
+			}
+		}
+		if wt.Path != "" {
+			wts = append(wts, wt)
+		}
+	}
+	return wts
+}
+
+type prInfo struct {
+	Branch  string `json:"branch"`
+	Number  int    `json:"number"`
+	State   string `json:"state"`
+	Base    string `json:"base"`
+	URL     string `json:"url"`
+	HeadSHA string `json:"head_sha"`
+	CI      string `json:"ci"`
+}
+
+func newPRInfo(br string, cp cachedPR) prInfo {
+	return prInfo{Branch: br, Number: cp.Number, State: cp.State, Base: cp.Base, URL: cp.URL, HeadSHA: cp.HeadSHA, CI: cp.CI}
+}
+
+type headInfo struct {
+	Branch   string `json:"branch"`
+	Commit   string `json:"commit"`
+	Detached bool   `json:"detached"`
+}
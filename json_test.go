@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// jsonKeys returns the sorted keys of v encoded as a json object.
+func jsonKeys(t *testing.T, v any) []string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// TestJSONSchema pins the field names of the --json output. Renaming or dropping a field
+// breaks the scripts that read it, so update the consumers before updating this test.
+func TestJSONSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		keys string
+	}{
+		{"log", commitInfo{}, "author date email hash short subject"},
+		{"commit", commitDetail{}, "author body date email files hash short subject"},
+		{"status", statusInfo{}, "ahead behind branch branches commit entries upstream"},
+		{"status entry", statusEntry{}, "index kind orig_path path worktree"},
+		{"branch", branchInfo{}, "ahead behind ci commit current name parent pr pr_state subject time upstream upstream_ahead upstream_behind upstream_gone worktree"},
+		{"pr", prInfo{}, "base branch ci head_sha number state url"},
+		{"worktree", worktreeInfo{}, "bare branch detached head locked path prunable"},
+		{"head", headInfo{}, "branch commit detached"},
+	}
+	for _, tc := range tests {
+		if got := strings.Join(jsonKeys(t, tc.v), " "); got != tc.keys {
+			t.Errorf("%s json keys = %s, want %s", tc.name, got, tc.keys)
+		}
+	}
+}
+
+func TestWorktreeStatusJSON(t *testing.T) {
+	r := newTestRepo(t)
+	os.WriteFile(filepath.Join(r.dir, "a.txt"), []byte("a\n"), 0o644)
+	os.WriteFile(filepath.Join(r.dir, "b.txt"), []byte("b\n"), 0o644)
+	r.git(r.dir, "add", "a.txt", "b.txt")
+	r.git(r.dir, "commit", "-q", "-m", "add files")
+	os.WriteFile(filepath.Join(r.dir, "a.txt"), []byte("a2\n"), 0o644)
+	r.git(r.dir, "mv", "b.txt", "c.txt")
+	os.WriteFile(filepath.Join(r.dir, "new.txt"), []byte("n\n"), 0o644)
+	chdir(t, r.dir)
+
+	st := worktreeStatus(true)
+	if st.Branch != "main" || st.Commit != r.git(r.dir, "rev-parse", "HEAD") {
+		t.Errorf("status branch = %s %s", st.Branch, st.Commit)
+	}
+	want := []statusEntry{
+		{Path: "a.txt", Kind: "changed", Index: ".", Worktree: "M"},
+		{Path: "c.txt", OrigPath: "b.txt", Kind: "renamed", Index: "R", Worktree: "."},
+		{Path: "new.txt", Kind: "untracked", Index: "?", Worktree: "?"},
+	}
+	if !slices.Equal(st.Entries, want) {
+		t.Errorf("status entries = %+v, want %+v", st.Entries, want)
+	}
+
+	// lists are [] rather than null
+	b, _ := json.Marshal(statusInfo{Entries: []statusEntry{}, Branches: []branchInfo{}})
+	if s := string(b); !strings.Contains(s, `"entries":[]`) || !strings.Contains(s, `"branches":[]`) {
+		t.Errorf("empty status json = %s", s)
+	}
+}
+
+func TestListCommitsJSON(t *testing.T) {
+	r := newTestRepo(t)
+	chdir(t, r.dir)
+	cms := listCommits("-n 2 --")
+	if len(cms) != 2 {
+		t.Fatalf("listCommits returned %d commits, want 2", len(cms))
+	}
+	cm := cms[0]
+	if cm.Hash != r.git(r.dir, "rev-parse", "HEAD") || cm.Short != r.git(r.dir, "rev-parse", "--short", "HEAD") ||
+		cm.Author != "Test" || cm.Email != "t@example.com" || cm.Subject != "second" || cm.Date.IsZero() {
+		t.Errorf("listCommits[0] = %+v", cm)
+	}
+	if cms := listCommits("-n 1 HEAD..HEAD --"); cms == nil || len(cms) != 0 {
+		t.Errorf("listCommits of an empty range = %#v, want []", cms)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncoder/check"
+)
+
+var commitTypes = []struct{ Type, Desc string }{
+	{"feat", "a new feature"},
+	{"fix", "a bug fix"},
+	{"docs", "documentation only"},
+	{"style", "formatting, no code change"},
+	{"refactor", "neither a fix nor a feature"},
+	{"perf", "performance improvement"},
+	{"test", "adding or fixing tests"},
+	{"build", "build system or dependencies"},
+	{"ci", "ci configuration"},
+	{"chore", "other changes"},
+	{"revert", "revert a commit"},
+}
+
+type lintConfig struct {
+	Enabled    bool
+	Types      []string
+	SubjectMax int
+	BodyWrap   int
+	Ticket     bool
+}
+
+func configBool(key string, def bool) bool {
+	b, err := strconv.ParseBool(gitConfig(key, strconv.FormatBool(def)))
+	check.E(err).F("invalid bool config", "key", "mygit."+key)
+	return b
+}
+
+func configInt(key string, def int) int {
+	n, err := strconv.Atoi(gitConfig(key, strconv.Itoa(def)))
+	check.E(err).F("invalid int config", "key", "mygit."+key)
+	return n
+}
+
+func loadLintConfig() lintConfig {
+	var types []string
+	for _, t := range commitTypes {
+		types = append(types, t.Type)
+	}
+	lc := lintConfig{
+		Enabled:    configBool("lint", false),
+		SubjectMax: configInt("lintSubjectMax", 72),
+		BodyWrap:   configInt("lintBodyWrap", 72),
+		Ticket:     configBool("lintTicket", false),
+	}
+	if vs := configValues("mygit.lintTypes"); len(vs) > 0 {
+		types = nil
+		for _, t := range strings.Split(vs[len(vs)-1], ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+	lc.Types = types
+	return lc
+}
+
+var trailerRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*: `)
+
+func lintMessage(msg string, lc lintConfig) []string {
+	// git keeps the # lines of a message given by -m or -F without an editor
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		return []string{"message is empty"}
+	}
+	var lns []string
+	for _, ln := range strings.Split(msg, "\n") {
+		lns = append(lns, strings.TrimRight(ln, " \t"))
+	}
+	subject := stripTicketPrefix(lns[0])
+
+	var probs []string
+	if subject == "" {
+		return []string{"empty subject"}
+	}
+	if len(lc.Types) > 0 {
+		mo := convCommitRe.FindStringSubmatch(subject)
+		switch {
+		case mo == nil:
+			probs = append(probs, fmt.Sprintf("subject is not <type>[(scope)][!]: <description>, type is one of %s", strings.Join(lc.Types, ",")))
+		case !slices.Contains(lc.Types, mo[1]):
+			probs = append(probs, fmt.Sprintf("unknown type %q, want one of %s", mo[1], strings.Join(lc.Types, ",")))
+		case strings.HasPrefix(subject, mo[1]+"()"):
+			probs = append(probs, "empty scope")
+		case !strings.Contains(subject, ": "):
+			probs = append(probs, "no space after colon")
+		}
+	}
+	if n := len([]rune(subject)); lc.SubjectMax > 0 && n > lc.SubjectMax {
+		probs = append(probs, fmt.Sprintf("subject is %d chars, longer than %d", n, lc.SubjectMax))
+	}
+	if strings.HasSuffix(subject, ".") {
+		probs = append(probs, "subject ends with a period")
+	}
+	if len(lns) > 1 && lns[1] != "" {
+		probs = append(probs, "no blank line between subject and body")
+	}
+	for i, ln := range lns[1:] {
+		// urls and trailers can't wrap
+		if lc.BodyWrap > 0 && len([]rune(ln)) > lc.BodyWrap && !strings.Contains(ln, "://") && !trailerRe.MatchString(ln) {
+			probs = append(probs, fmt.Sprintf("body line %d is longer than %d", i+2, lc.BodyWrap))
+		}
+	}
+	if lc.Ticket && len(parseIssues(strings.Join(lns, "\n"))) == 0 {
+		probs = append(probs, "no ticket reference")
+	}
+	return probs
+}
+
+func checkMessage(msg string) {
+	lc := loadLintConfig()
+	if !lc.Enabled {
+		return
+	}
+	probs := lintMessage(msg, lc)
+	for _, p := range probs {
+		log.Printf("lint: %s", p)
+	}
+	check.T(len(probs) == 0).F("commit message lint failed, -n to skip", "subject", strings.SplitN(msg, "\n", 2)[0])
+}
+
+func joinMessage(args []string) string {
+	return strings.Join(args, "\n\n")
+}
+
+func skipLint(subject string) bool {
+	s := strings.ToLower(stripTicketPrefix(subject))
+	return s == "wip" || strings.HasPrefix(s, "fixup! ") || strings.HasPrefix(s, "squash! ") || strings.HasPrefix(s, "amend! ")
+}
+
+func lintUnpushed() {
+	lc := loadLintConfig()
+	if !lc.Enabled {
+		return
+	}
+	base := fmt.Sprintf("origin/%s", MainBranch())
+	if shQ("git rev-parse -q --verify %s", base) == "" {
+		return
+	}
+	s := sh("git log --format=%s %s..HEAD", "%h%x00%B%x1e", base)
+	failed := false
+	for _, rec := range strings.Split(s, "\x1e") {
+		h, msg, ok := strings.Cut(strings.TrimSpace(rec), "\x00")
+		if !ok || skipLint(strings.SplitN(msg, "\n", 2)[0]) {
+			continue
+		}
+		for _, p := range lintMessage(msg, lc) {
+			log.Printf("lint %s: %s", h, p)
+			failed = true
+		}
+	}
+	check.T(!failed).F("commit message lint failed, -n to skip")
+}
+
+func changedScope() string {
+	s := sh("git diff --cached --name-only")
+	if s == "" {
+		s = sh("git diff --name-only")
+	}
+	if s == "" {
+		return ""
+	}
+	var scope string
+	for i, f := range strings.Split(s, "\n") {
+		top, _, ok := strings.Cut(f, "/")
+		if !ok || (i > 0 && top != scope) {
+			return ""
+		}
+		scope = top
+	}
+	return scope
+}
+
+type prompter struct {
+	r *bufio.Reader
+}
+
+func (p prompter) ask(q, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", q, def)
+	} else {
+		fmt.Printf("%s: ", q)
+	}
+	s, err := p.r.ReadString('\n')
+	check.T(err == nil || s != "").F("read stdin", "err", err)
+	if s = strings.TrimSpace(s); s == "" {
+		return def
+	}
+	return s
+}
+
+func buildMessage() string {
+	p := prompter{r: bufio.NewReader(os.Stdin)}
+	lc := loadLintConfig()
+
+	for i, t := range commitTypes {
+		fmt.Printf("%2d. %-9s %s\n", i+1, t.Type, t.Desc)
+	}
+	var typ string
+	for typ == "" {
+		s := p.ask("type", "")
+		if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= len(commitTypes) {
+			typ = commitTypes[n-1].Type
+		} else if len(lc.Types) == 0 || slices.Contains(lc.Types, s) {
+			typ = s
+		}
+	}
+	scope := p.ask("scope, - for none", changedScope())
+	if scope == "-" {
+		scope = ""
+	}
+	var subject string
+	for subject == "" {
+		subject = strings.TrimSuffix(p.ask("subject", ""), ".")
+	}
+	breaking := p.ask("breaking change (y/n)", "n") == "y"
+
+	fmt.Println("body, end with an empty line:")
+	var body []string
+	for {
+		s, err := p.r.ReadString('\n')
+		if s = strings.TrimRight(s, "\r\n"); s == "" || err != nil {
+			break
+		}
+		body = append(body, s)
+	}
+
+	ticket := p.ask("ticket, - for none", branchTicket())
+	if ticket == "-" {
+		ticket = ""
+	}
+	var sb strings.Builder
+	if ticket != "" && ticketStyle() == "prefix" {
+		fmt.Fprintf(&sb, "[%s] ", ticket)
+	}
+	sb.WriteString(typ)
+	if scope != "" {
+		fmt.Fprintf(&sb, "(%s)", scope)
+	}
+	if breaking {
+		sb.WriteByte('!')
+	}
+	fmt.Fprintf(&sb, ": %s\n", subject)
+	if len(body) > 0 {
+		fmt.Fprintf(&sb, "\n%s\n", strings.Join(body, "\n"))
+	}
+	if ticket != "" && ticketStyle() != "prefix" {
+		fmt.Fprintf(&sb, "\nRefs: %s\n", ticket)
+	}
+	msg := sb.String()
+
+	fmt.Printf("\n%s\n", msg)
+	if lc.Enabled {
+		for _, prob := range lintMessage(msg, lc) {
+			log.Printf("lint: %s", prob)
+		}
+	}
+	check.T(p.ask("commit (y/n)", "y") == "y").F("aborted")
+	return msg
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLintMessage(t *testing.T) {
+	lc := lintConfig{Enabled: true, Types: []string{"feat", "fix"}, SubjectMax: 72, BodyWrap: 72}
+	tests := []struct {
+		msg  string
+		want []string
+	}{
+		{"fix: a bug", nil},
+		{"", []string{"message is empty"}},
+		{"  \n\n", []string{"message is empty"}},
+		{"#42 fix", []string{"subject is not <type>[(scope)][!]: <description>, type is one of feat,fix"}},
+		{"fix: a bug\n\n# not a comment", nil},
+		{"fix: a bug.", []string{"subject ends with a period"}},
+		{"fix: a bug\nbody", []string{"no blank line between subject and body"}},
+		{"[PROJ-1] fix: a bug", nil},
+		{"docs: a doc", []string{`unknown type "docs", want one of feat,fix`}},
+	}
+	for _, tc := range tests {
+		if got := lintMessage(tc.msg, lc); !slices.Equal(got, tc.want) {
+			t.Errorf("lintMessage(%q) = %q, want %q", tc.msg, got, tc.want)
+		}
+	}
+}
+
+func TestLintDecoratedMessage(t *testing.T) {
+	r := newTestRepo(t)
+	r.git(r.dir, "checkout", "-q", "-b", "u/PROJ-12-fix")
+	r.git(r.dir, "config", "mygit.ticketRe", `[A-Z]+-[0-9]+`)
+	r.git(r.dir, "config", "mygit.lint", "true")
+	r.git(r.dir, "config", "mygit.lintTicket", "true")
+	r.git(r.dir, "update-ref", "refs/remotes/origin/main", "main")
+	chdir(t, r.dir)
+	repoDir, gitDir, gitCommonDir, curBranch = "", "", "", ""
+	t.Cleanup(func() { repoDir, gitDir, gitCommonDir, curBranch = "", "", "", "" })
+
+	lc := loadLintConfig()
+	if probs := lintMessage("fix: a bug", lc); !slices.Equal(probs, []string{"no ticket reference"}) {
+		t.Errorf("lintMessage(undecorated) = %q, want no ticket reference", probs)
+	}
+	msg := decorateMessage("fix: a bug")
+	if probs := lintMessage(msg, lc); len(probs) > 0 {
+		t.Errorf("lintMessage(%q) = %q, want none", msg, probs)
+	}
+
+	// PS_ lints the committed message, which is the decorated one
+	r.git(r.dir, "commit", "-q", "--allow-empty", "-m", msg)
+	lintUnpushed()
+}
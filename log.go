@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+func logRev(s string, remote bool) string {
+	for _, sep := range []string{"...", ".."} {
+		if a, b, ok := strings.Cut(s, sep); ok {
+			if a != "" {
+				a = logRev(a, remote)
+			}
+			if b != "" {
+				b = logRev(b, remote)
+			}
+			return a + sep + b
+		}
+	}
+	if remote && !isCommit(unaliasHead(s)) {
+		return "origin/" + remoteBranch(s)
+	}
+	return resolveRev(s)
+}
+
+func logFilters(mine bool, since, until, grep string) []string {
+	var args []string
+	if mine {
+		author := configGet("user.email")
+		if author == "" {
+			author = Username()
+		}
+		args = append(args, "--author="+author)
+	}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	if until != "" {
+		args = append(args, "--until="+until)
+	}
+	if grep != "" {
+		args = append(args, "-i", "-E", "--grep="+grep)
+	}
+	return args
+}
+
+func printLogGraph(args []string) {
+	locals := make(map[string]bool)
+	for _, br := range strings.Split(sh("git for-each-ref --format='%s' refs/heads", "%(refname:short)"), "\n") {
+		locals[br] = true
+	}
+	color := useColor()
+	format := "--format=%x00%h%x00%D%x00%s%x00%an%x00%cr"
+	s := gitOut(append([]string{"log", "--graph", colorFlag(), format}, args...)...)
+	for _, ln := range strings.Split(s, "\n") {
+		fs := strings.Split(ln, "\x00")
+		if len(fs) != 6 {
+			fmt.Println(ln)
+			continue
+		}
+		graph, hash, refs, subject, author, date := fs[0], fs[1], fs[2], fs[3], fs[4], fs[5]
+		for _, ref := range strings.Split(refs, ", ") {
+			br := strings.TrimPrefix(ref, "HEAD -> ")
+			if !locals[br] || br == MainBranch() {
+				continue
+			}
+			mark := "── " + br
+			if cp, ok := lookupPR(br); ok && cp.Number > 0 {
+				mark += fmt.Sprintf(" #%d", cp.Number)
+			}
+			if color {
+				mark = colorGreen + mark + colorReset
+			}
+			fmt.Printf("%s%s\n", strings.Replace(graph, "*", "|", 1), mark)
+		}
+		var pr string
+		if mo := prInTitleRe.FindString(subject); mo != "" {
+			n, _ := strconv.Atoi(strings.Trim(mo, "(#)"))
+			pr = fmt.Sprintf("#%d ", n)
+			subject = strings.TrimSpace(strings.TrimSuffix(subject, mo))
+		}
+		meta := fmt.Sprintf("%s, %s", author, date)
+		if color {
+			hash = colorYellow + hash + colorReset
+			meta = colorDim + meta + colorReset
+		}
+		fmt.Printf("%s%s %s%s  %s\n", graph, hash, pr, subject, meta)
+	}
+}
+
+func (OpList) SL_ListCommits() {
+	remote := flag.Bool("r", false, "remote branch")
+	mine := flag.Bool("mine", false, "my commits only")
+	path := flag.String("p", "", "commits touching the path only")
+	since := flag.String("since", "", "commits after the date, e.g. 2024-05-01 or '2 weeks ago'")
+	until := flag.String("until", "", "commits before the date")
+	grep := flag.String("grep", "", "commits with the message matching the extended regex")
+	sinceBase := flag.Bool("since-base", false, "commits not on trunk yet")
+	graph := flag.Bool("graph", false, "show a graph with the stack boundaries and prs")
+	mygo.ParseFlag("[branch_re_or_range]", "[n_commits]")
+
+	var pat string
+	num := -1
+	for _, s := range flag.Args() {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			pat = s
+		} else {
+			num = n
+		}
+	}
+
+	var rev string
+	if pat != "" {
+		rev = logRev(pat, *remote)
+	}
+	isRange := strings.Contains(rev, "..")
+	if *sinceBase {
+		check.T(!isRange).F("-since-base cannot be used with a range", "range", rev)
+		if rev == "" {
+			rev = "HEAD"
+		}
+		rev = fmt.Sprintf("%s..%s", trunkRef(), rev)
+		isRange = true
+	}
+	// a range is shown in full unless n_commits is given
+	if num < 0 && !isRange {
+		num = 3
+	}
+
+	args := logFilters(*mine, *since, *until, *grep)
+	if num >= 0 {
+		args = append(args, "-n", strconv.Itoa(num))
+	}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	if *path != "" {
+		args = append(args, *path)
+	}
+
+	if *jsonOut {
+		printJSON(logCommits(args...))
+		return
+	}
+	if *graph {
+		printLogGraph(args)
+		return
+	}
+	s := gitOut(append([]string{"log", "--format=%h    %s%n%cd    %an%n", "--date=local"}, args...)...)
+	fmt.Println(s)
+}
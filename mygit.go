@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -19,7 +21,14 @@ import (
 type OpList struct{} // placeholder to help discover methods
 
 func checkoutBranch(br string, revertBuf bool) {
+	auto := autoStash() && br != getCurBranch()
+	if auto {
+		stashOnLeave()
+	}
 	sh("git checkout %s", br)
+	if auto {
+		restoreOnReturn()
+	}
 	if revertBuf {
 		revertEmacsBuffers()
 	}
@@ -39,6 +48,14 @@ func shQ(s string, args ...any) string {
 
 var verbose = flag.Bool("v", false, "show commands")
 
+func gitOut(args ...string) string {
+	// no shell, so user patterns are passed as they are
+	if *verbose {
+		log.Println("git", strings.Join(args, " "))
+	}
+	return string(bytes.TrimSpace(mygo.NewCmd("git", args...).Silent(!*verbose).Stdout()))
+}
+
 func shellCmd(s string, ignoreErr bool, args ...any) string {
 	if len(args) > 0 {
 		s = fmt.Sprintf(s, args...)
@@ -54,6 +71,8 @@ func shellCmd(s string, ignoreErr bool, args ...any) string {
 
 var (
 	repoDir,
+	gitDir,
+	gitCommonDir,
 	curBranch,
 	mainBranch,
 	repoBranch,
@@ -63,12 +82,44 @@ var (
 
 func RepoDir() string {
 	if repoDir == "" {
-		repoDir = shQ("git rev-parse --show-toplevel")
+		if top, _, _, ok := nativeRepo(); ok {
+			repoDir = top
+		} else {
+			repoDir = shQ("git rev-parse --show-toplevel")
+		}
 	}
 	return repoDir
 }
 
+func GitDir() string {
+	if gitDir == "" {
+		if _, gd, _, ok := nativeRepo(); ok {
+			gitDir = gd
+		} else {
+			gitDir = sh("git rev-parse --absolute-git-dir")
+		}
+	}
+	return gitDir
+}
+
+func GitCommonDir() string {
+	if gitCommonDir == "" {
+		if _, _, cd, ok := nativeRepo(); ok {
+			gitCommonDir = cd
+			return gitCommonDir
+		}
+		gitCommonDir = sh("git rev-parse --git-common-dir")
+		if !filepath.IsAbs(gitCommonDir) {
+			gitCommonDir = check.V(filepath.Abs(gitCommonDir)).F("abs", "dir", gitCommonDir)
+		}
+	}
+	return gitCommonDir
+}
+
 func getCurBranch() string {
+	if br, ok := nativeCurBranch(); ok {
+		return br
+	}
 	br := sh("git rev-parse --abbrev-ref HEAD")
 	if br == "HEAD" {
 		br = sh("git rev-parse --short HEAD")
@@ -85,7 +136,7 @@ func CurBranch() string {
 
 func Username() string {
 	if username == "" {
-		username = sh("git config --get github.username")
+		username = configGet("github.username")
 		if username == "" {
 			u := check.V(user.Current()).F("username")
 			username = u.Username
@@ -95,9 +146,33 @@ func Username() string {
 	return username
 }
 
+func MygitDir() string {
+	return filepath.Join(GitCommonDir(), "mygit")
+}
+
+func makeMygitDir() {
+	check.E(os.MkdirAll(MygitDir(), 0o755)).F("mkdir", "dir", MygitDir())
+}
+
+func gitConfig(key, def string) string {
+	if v := configGet("mygit." + key); v != "" {
+		return v
+	}
+	return def
+}
+
 func MainBranch() string {
 	if mainBranch == "" {
-		mainBranch = sh(`git branch -l main master --format '%(refname:short)'`)
+		if _, gd, cd, ok := nativeRepo(); ok {
+			for _, br := range []string{"main", "master"} {
+				if _, ok := resolveRef(gd, cd, "refs/heads/"+br); ok {
+					mainBranch = br
+					break
+				}
+			}
+		} else {
+			mainBranch = sh(`git branch -l main master --format '%(refname:short)'`)
+		}
 	}
 	return mainBranch
 }
@@ -113,17 +188,21 @@ func RepoBranch() string {
 
 func MainWorktreeDir() string {
 	if mainWorktreeDir == "" {
-		var dir string
-		s := sh("git worktree list")
-		lns := strings.Split(s, "\n")
-		for _, ln := range lns {
-			if strings.Contains(ln, "/wt-") {
+		var dirs []string
+		if _, _, cd, ok := nativeRepo(); ok {
+			dirs, _ = worktreeDirs(cd)
+		} else {
+			for _, ln := range strings.Split(sh("git worktree list"), "\n") {
+				dirs = append(dirs, strings.Fields(ln)[0])
+			}
+		}
+		for _, dir := range dirs {
+			if strings.Contains(dir, "/wt-") {
 				continue
 			}
-			check.T(dir == "").F("main worktree not unique", "worktree_list", lns)
-			dir = strings.Fields(ln)[0]
+			check.T(mainWorktreeDir == "").F("main worktree not unique", "worktrees", dirs)
+			mainWorktreeDir = dir
 		}
-		return dir
 	}
 	return mainWorktreeDir
 }
@@ -136,10 +215,15 @@ func localBranch(pat string, inUse bool) string {
 
 const tmpSuffix = "__TMP"
 
+const splitBackupSuffix = "__split-backup"
+
 func matchLocalBranches(pat string, inUse, tmp bool) []string {
 	var brs []string
 	re := regexp.MustCompile(pat)
-	s := sh("git branch")
+	s, ok := nativeBranchList()
+	if !ok {
+		s = sh("git branch")
+	}
 	for _, ln := range strings.Split(s, "\n") {
 		ln = strings.TrimSpace(ln)
 		if ln == "" {
@@ -219,7 +303,7 @@ func pullMain() {
 	cb := getCurBranch()
 	check.T(cb == bm).F("not in main branch", "current_branch", cb, "main_branch", bm)
 	log.Printf("pull in %s", bm)
-	sh("git pull --rebase")
+	shReplay("git pull --rebase")
 
 	if onWt {
 		log.Printf("cd worktree dir: %s", wd)
@@ -229,19 +313,13 @@ func pullMain() {
 		log.Printf("switch to repo branch: %s", br)
 		checkoutBranch(br, false)
 	}
-	sh("git rebase %s", bm)
+	shReplay("git rebase %s", bm)
 
 	if bc != bm || bc != br {
 		checkoutBranch(bc, false)
 	}
 }
 
-func (OpList) BB_Branch() {
-	mygo.ParseFlag()
-	s := sh("git branch -v")
-	fmt.Println("  " + s)
-}
-
 func (OpList) BO_CheckoutLocalBranch() {
 	revertBuf := flag.Bool("r", false, "revert emacs buffers")
 	mygo.ParseFlag("[branch_re]")
@@ -377,22 +455,90 @@ func deleteThisBranch() {
 
 func (OpList) CA_CherryPickAbort() {
 	mygo.ParseFlag()
-	sh("git cherry-pick --abort")
+	abortOp("cherry-pick")
 }
 
 func (OpList) CC_CherryPickContinue() {
 	mygo.ParseFlag()
-	sh("git cherry-pick --continue")
+	continueOp("cherry-pick", false, false)
 }
 
 func (OpList) CP_CherryPick() {
-	mygo.ParseFlag("commit_or_branch_re")
-	cm := flag.Arg(0)
+	remote := flag.Bool("r", false, "remote branch")
+	trailer := flag.Bool("x", false, "record the cherry-picked commit")
+	mygo.ParseFlag("commit_or_range_or_branch_re_or_pr<n>", "[...]")
+
+	var cms []string
+	for _, arg := range flag.Args() {
+		cms = append(cms, cherryPickCommits(arg, *remote)...)
+	}
+	var x string
+	if *trailer {
+		x = "-x "
+	}
+	shReplay("git cherry-pick %s%s", x, strings.Join(cms, " "))
+}
+
+var prArgRe = regexp.MustCompile(`^(?:#|pr)?([0-9]+)$`)
+
+func cherryPickCommits(arg string, remote bool) []string {
+	// #n works only quoted, since it starts a comment in the shell
+	switch mo := prArgRe.FindStringSubmatch(arg); {
+	case mo != nil && !isCommit(arg):
+		_, cms := fetchPRCommits(mo[1])
+		return cms
+	case strings.Contains(arg, ".."):
+		from, to, _ := strings.Cut(arg, "..")
+		return []string{unaliasHead(from) + ".." + unaliasHead(to)}
+	case isCommit(unaliasHead(arg)):
+		return []string{unaliasHead(arg)}
+	case remote:
+		br := remoteBranch(arg)
+		sh("git fetch origin %s", br)
+		return []string{"origin/" + br}
+	default:
+		return []string{localBranch(arg, true)}
+	}
+}
 
-	if !isCommit(cm) {
-		cm = localBranch(cm, true)
+func fetchPRCommits(pr string) (string, []string) {
+	var info struct {
+		Title   string
+		Commits []struct{ Oid string }
+	}
+	s := sh("gh pr view %s --json title,commits", pr)
+	check.E(json.Unmarshal([]byte(s), &info)).F("parse pr", "pr", pr)
+	check.T(len(info.Commits) > 0).F("no commit in pr", "pr", pr)
+	sh("git fetch origin pull/%s/head", pr)
+
+	var cms []string
+	for _, c := range info.Commits {
+		cms = append(cms, c.Oid)
+	}
+	return info.Title, cms
+}
+
+func (OpList) CB_Backport() {
+	silent := flag.Bool("s", false, "don't open browser")
+	mygo.ParseFlag("pr", "release_branch_re")
+	pr := strings.TrimPrefix(flag.Arg(0), "#")
+	rel := remoteBranch(flag.Arg(1))
+	checkWorktreeClean()
+
+	title, cms := fetchPRCommits(pr)
+	br := fmt.Sprintf("%s/backport-%s-%s", Username(), pr, strings.ReplaceAll(rel, "/", "-"))
+	log.Printf("backport #%s to %s in %s", pr, rel, br)
+	sh("git fetch origin %s", rel)
+	sh("git checkout -b %s origin/%s", br, rel)
+	shReplay("git cherry-pick -x %s", strings.Join(cms, " "))
+	sh("git push origin HEAD:%s", br)
+
+	body := fmt.Sprintf("Backport of #%s to `%s`.", pr, rel)
+	mygo.NewCmd("gh", "pr", "create", "-B", rel, "-H", br, "-t", title, "-b", body).Silent(!*verbose).Run()
+	invalidatePRCache()
+	if !*silent {
+		showPR(br)
 	}
-	sh("git cherry-pick %s", cm)
 }
 
 func (OpList) CF_FormatPatch() {
@@ -418,7 +564,7 @@ func (OpList) PU_Upstream() {
 		checkoutBranch(bm, false)
 		defer checkoutBranch(bc, false)
 	}
-	sh("git rebase upstream/%s", bm)
+	shReplay("git rebase upstream/%s", bm)
 }
 
 func (OpList) PL_Pull() {
@@ -429,7 +575,12 @@ func (OpList) PL_Pull() {
 
 func (OpList) PS_Push() {
 	force := flag.Bool("f", false, "force push")
+	noCheck := flag.Bool("n", false, "skip the commit message lint and signature check")
 	mygo.ParseFlag()
+	if !*noCheck {
+		lintUnpushed()
+		verifyUnpushed()
+	}
 
 	bc := CurBranch()
 	bm := MainBranch()
@@ -459,6 +610,7 @@ func (OpList) PS_Push() {
 }
 
 func (OpList) PO_SubmoduleUpdate() {
+	mygo.ParseFlag()
 	sh("git submodule update --init")
 }
 
@@ -468,11 +620,14 @@ func (OpList) MW_Wip() {
 	br := RepoBranch()
 	bm := MainBranch()
 	check.T(bc != br && bc != bm).F("cannot wip on default branch", "main", bm, "repo", br)
-	if isStaged() {
-		sh("git commit -m wip")
-	} else {
-		sh("git commit -a -m wip")
+	if !isStaged() {
+		sh("git add -u")
 	}
+	commitWithMessage(decorateMessage("wip"), false)
+}
+
+func checkWorktreeClean() {
+	check.T(sh("git status --porcelain -uno") == "").F("worktree is not clean")
 }
 
 func isStaged() bool {
@@ -480,29 +635,26 @@ func isStaged() bool {
 	return strings.TrimSpace(s) != ""
 }
 
+func hasStagedChanges() bool {
+	// unlike diff-index, diff ignores the intent-to-add files of reset -N
+	return mygo.NewCmd("git", "diff", "--cached", "--quiet").Silent(true).RunWithExitCode() == 1
+}
+
 func (OpList) MR_DiscardModified() {
 	mygo.ParseFlag("file...")
 	s := quoteArgs(flag.Args(), "")
 	matched := sh("git ls-files -m %s", s)
 	mygo.Yorn("discard modified: %s", strings.Replace(matched, "\n", " ", -1))
-	sh("git checkout %s", s)
-}
-
-func (OpList) MX_Clean() {
-	mygo.ParseFlag()
-	s := sh("git ls-files --others --exclude-standard")
-	s = strings.TrimSpace(s)
-	if s == "" {
-		log.Println("no file to clean")
-		return
+	if matched != "" {
+		trashFiles("mr", strings.Split(matched, "\n"))
 	}
-	mygo.Yorn("delete these files?\n%s\n", s)
-	sh("git clean -f")
+	sh("git checkout %s", s)
 }
 
 func (OpList) MC_Commit() {
 	force := flag.Bool("f", false, "force commit")
-	mygo.ParseFlag("commit_message...")
+	noLint := flag.Bool("n", false, "skip the commit message lint")
+	mygo.ParseFlag("[commit_message...]")
 
 	if !*force {
 		bc := CurBranch()
@@ -510,12 +662,20 @@ func (OpList) MC_Commit() {
 		br := RepoBranch()
 		check.T(bc != bm && bc != br).F("cannot commit to default branch", "main", bm, "repo", br)
 	}
-	msg := quoteArgs(flag.Args(), "-m")
-	if isStaged() {
-		sh("git commit %s", msg)
+	var msg string
+	if flag.NArg() == 0 {
+		msg = buildMessage()
 	} else {
-		sh("git commit -a %s", msg)
+		msg = joinMessage(flag.Args())
+	}
+	msg = decorateMessage(msg)
+	if flag.NArg() > 0 && !*noLint {
+		checkMessage(msg)
 	}
+	if !isStaged() {
+		sh("git add -u")
+	}
+	commitWithMessage(msg, false)
 }
 
 func (OpList) MA_AddFiles() {
@@ -544,19 +704,21 @@ func quoteArgs(args []string, prefix string) string {
 }
 
 func (OpList) MM_AmendLastCommit() {
-	mygo.ParseFlag("commit_message...")
-	msg := quoteArgs(flag.Args(), "-m")
-	sh("git commit --amend %s", msg)
-}
-
-func (OpList) MH_Stash() {
-	mygo.ParseFlag()
-	sh("git stash")
-}
-
-func (OpList) MS_PopStash() {
-	mygo.ParseFlag()
-	sh("git stash pop")
+	noLint := flag.Bool("n", false, "skip the commit message lint")
+	mygo.ParseFlag("[commit_message...]")
+	// keep the message if none is given, and add the missing trailers
+	msg := sh("git log -n 1 --format=%B")
+	if flag.NArg() > 0 {
+		msg = joinMessage(flag.Args())
+	}
+	msg = decorateMessage(msg)
+	if flag.NArg() > 0 && !*noLint {
+		checkMessage(msg)
+	}
+	fn := writeMsgFile(msg)
+	defer os.Remove(fn)
+	signCommits()
+	sh(`git commit --amend -F "%s"`, fn)
 }
 
 func (OpList) MU_Unstage() {
@@ -630,18 +792,19 @@ func (OpList) RI_RebaseInteractive() {
 	if !strings.Contains(cm, "~") && !strings.Contains(cm, "^") && !isCommit(cm) {
 		cm = localBranch(cm, true)
 	}
+	signCommits()
 	sh("git rebase -i %s", cm)
 	// revertEmacsBuffers()
 }
 
 func (OpList) RC_RebaseCont() {
 	mygo.ParseFlag()
-	sh("git add")
-	sh("git rebase --continue")
+	continueOp("rebase", false, false)
 }
 
 func (OpList) RA_RebaseAbort() {
-	sh("git rebase --abort")
+	mygo.ParseFlag()
+	abortOp("rebase")
 }
 
 func (OpList) RR_Rebase() {
@@ -655,7 +818,7 @@ func (OpList) RR_Rebase() {
 		br = localBranch(flag.Arg(0), true)
 	}
 	if bc != br {
-		sh("git rebase %s", br)
+		shReplay("git rebase %s", br)
 	}
 	revertEmacsBuffers()
 }
@@ -679,7 +842,7 @@ func (OpList) RB_RebaseBackOnto() {
 	bcTmp := bc + tmpSuffix
 	shQ("git branch -D %s", bcTmp)
 	sh("git branch %s HEAD~%d", bcTmp, *numCommits)
-	sh("git rebase --onto %s %s %s", onto, bcTmp, bc)
+	shReplay("git rebase --onto %s %s %s", onto, bcTmp, bc)
 	sh("git branch -D %s", bcTmp)
 	if *revert {
 		revertEmacsBuffers()
@@ -692,6 +855,9 @@ func (OpList) RB_RebaseBackOnto() {
 }
 
 func prState(pr string) string {
+	if cp, ok := lookupPR(pr); ok || *offline {
+		return cp.State
+	}
 	return shQ("gh pr view %s --json state -q .state", pr)
 }
 
@@ -701,72 +867,249 @@ func resetGithubBase(bb string) {
 	if bb != bm {
 		sh("git push --force origin %s:%s", bb, rbb)
 		sh("gh pr edit -B %s", rbb)
+		invalidatePRCache()
 	} else if matchRemoteBranches(rbb, true, true) != nil {
 		log.Printf("reset pr base to main")
 		sh("gh pr edit -B %s", bm)
+		invalidatePRCache()
 		sh("git push origin :%s", rbb)
 	}
 }
 
 func (OpList) RU_Uncommits() {
-	uncommitDeleteOrSquash("uncommit")
+	mygo.ParseFlag(commitRangeArg)
+	uncommitDeleteOrSquash("uncommit", false, false)
 }
 
 func (OpList) RD_DeleteCommits() {
-	uncommitDeleteOrSquash("delete")
+	mygo.ParseFlag(commitRangeArg)
+	uncommitDeleteOrSquash("delete", false, false)
 }
 
 func (OpList) RS_SquashToCommit() {
-	uncommitDeleteOrSquash("squash")
+	combine := flag.Bool("a", false, "combine messages of all squashed commits")
+	edit := flag.Bool("e", false, "edit message of the squashed commit")
+	mygo.ParseFlag(commitRangeArg)
+	uncommitDeleteOrSquash("squash", *combine, *edit)
 }
 
-func uncommitDeleteOrSquash(action string) {
-	mygo.ParseFlag("[n_commits_or_commit]")
-	cm, one := parseNumCommitsOrCommit(action == "squash")
-	start := sh("git rev-parse --short %s", cm)
-	end := sh("git rev-parse --short %s", CurBranch())
+const commitRangeArg = "[n_commits_or_commit_or_range]"
+
+func uncommitDeleteOrSquash(action string, combineMsg, editMsg bool) {
+	base, n := parseCommitRange(action == "squash")
+	start := strings.Fields(sh("git rev-list --reverse --abbrev-commit %s..HEAD", base))[0]
+	end := sh("git rev-parse --short HEAD")
 
 	switch action {
 	case "uncommit":
-		if one {
+		if n == 1 {
 			log.Printf("undo commits [%s..%s]", start, end)
 		} else {
-			mygo.Yorn("undo commits [%s..%s]", start, end)
+			mygo.Yorn("undo %d commits [%s..%s]", n, start, end)
 		}
-		sh("git reset --mixed %s~", cm)
+		sh("git reset --mixed %s", base)
 	case "delete":
-		mygo.Yorn("delete commits [%s..%s]", start, end)
-		sh("git reset --hard %s~", cm)
+		mygo.Yorn("delete %d commits [%s..%s]", n, start, end)
+		sh("git reset --hard %s", base)
 	case "squash":
-		if one {
+		if n == 2 {
 			log.Printf("squash commits [%s..%s]", start, end)
 		} else {
-			mygo.Yorn("squash commits [%s..%s]", start, end)
+			mygo.Yorn("squash %d commits [%s..%s]", n, start, end)
+		}
+		var msg string
+		if combineMsg {
+			msg = sh("git log --reverse --format=%%B %s..HEAD", base)
+		} else {
+			msg = sh("git show -s --format=%B " + start) // cannot format because of %B
 		}
-		msg := sh("git show -s --format=%B " + cm) // cannot format because of %B
-		sh("git reset --soft %s~", cm)
-		sh(`git commit -m '%s'`, msg)
+		sh("git reset --soft %s", base)
+		commitWithMessage(msg, editMsg)
 	default:
 		panic(action)
 	}
 }
 
-func parseNumCommitsOrCommit(squash bool) (string, bool) {
-	if flag.NArg() == 0 {
+func parseCommitRange(squash bool) (string, int) {
+	arg := flag.Arg(0)
+	var base string
+	switch {
+	case flag.NArg() == 0:
 		if squash {
-			return "HEAD~1", true
+			base = "HEAD~2"
+		} else {
+			base = "HEAD~"
+		}
+	case arg == "@base":
+		base = sh("git merge-base HEAD %s", MainBranch())
+	case strings.Contains(arg, ".."):
+		from, to, _ := strings.Cut(arg, "..")
+		if to != "" {
+			tip := sh("git rev-parse %s", unaliasHead(to))
+			check.T(tip == sh("git rev-parse HEAD")).F("range must end at HEAD", "range", arg)
+		}
+		base = unaliasHead(from)
+	default:
+		if n, err := strconv.Atoi(arg); err == nil {
+			check.T(n > 0).F("invalid n_commits", "n", n)
+			base = fmt.Sprintf("HEAD~%d", n)
+		} else {
+			base = unaliasHead(arg) + "~"
+		}
+	}
+
+	base = sh("git rev-parse --short %s", base)
+	check.T(isAncestor(base, "HEAD")).F("not an ancestor of HEAD", "base", base)
+	n := commitCount(base, "HEAD")
+	check.T(n > 0 && (n > 1 || !squash)).F("invalid commit range", "arg", arg, "n_commits", n)
+	return base, n
+}
+
+func isAncestor(a, b string) bool {
+	return mygo.NewCmd("git", "merge-base", "--is-ancestor", a, b).Silent(true).RunWithExitCode() == 0
+}
+
+func commitCount(from, to string) int {
+	return check.V(strconv.Atoi(sh("git rev-list --count %s..%s", from, to))).F("count commits", "from", from, "to", to)
+}
+
+type branchStack struct {
+	brs   []string
+	tips  map[string]string
+	reach map[string]map[string]bool // the commits of a branch not in main
+}
+
+func newBranchStack(brs []string) branchStack {
+	bs := branchStack{brs: brs, tips: make(map[string]string), reach: make(map[string]map[string]bool)}
+	for _, ln := range strings.Split(gitOut("for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads"), "\n") {
+		if br, sha, ok := strings.Cut(ln, " "); ok && slices.Contains(brs, br) {
+			bs.tips[br] = sha
+		}
+	}
+	args := []string{"rev-list", "--parents", "^" + MainBranch()}
+	for _, sha := range bs.tips {
+		args = append(args, sha)
+	}
+	parents := make(map[string][]string)
+	for _, ln := range strings.Split(gitOut(args...), "\n") {
+		if fs := strings.Fields(ln); len(fs) > 0 {
+			parents[fs[0]] = fs[1:]
+		}
+	}
+	for br, sha := range bs.tips {
+		seen := make(map[string]bool)
+		for todo := []string{sha}; len(todo) > 0; {
+			c := todo[len(todo)-1]
+			todo = todo[:len(todo)-1]
+			if ps, ok := parents[c]; ok && !seen[c] {
+				seen[c] = true
+				todo = append(todo, ps...)
+			}
+		}
+		bs.reach[br] = seen
+	}
+	return bs
+}
+
+func (bs branchStack) parent(br string) string {
+	// the nearest branch that br is ahead of
+	var parent string
+	best := 0
+	for _, b := range bs.brs {
+		if b == br || !bs.reach[br][bs.tips[b]] {
+			continue
+		}
+		if n := len(bs.reach[b]); n > best && n < len(bs.reach[br]) {
+			parent, best = b, n
+		}
+	}
+	return parent
+}
+
+func stackOf(br string) []string {
+	brs := matchLocalBranches("^"+regexp.QuoteMeta(Username())+"/", true, false)
+	if !slices.Contains(brs, br) {
+		brs = append(brs, br)
+	}
+	bs := newBranchStack(brs)
+	var stack []string
+	for b := br; b != ""; b = bs.parent(b) {
+		stack = append([]string{b}, stack...)
+	}
+	for b := br; ; {
+		var child string
+		for _, c := range brs {
+			if c != b && bs.parent(c) == b {
+				child = c
+				break
+			}
 		}
-		return "HEAD", true
+		if child == "" {
+			break
+		}
+		stack = append(stack, child)
+		b = child
+	}
+	return stack
+}
+
+func writeMsgFile(msg string) string {
+	f := check.V(os.CreateTemp("", "mygit-msg-*")).F("create msg file")
+	check.V(f.WriteString(msg)).F("write msg file", "file", f.Name())
+	check.E(f.Close()).F("close msg file", "file", f.Name())
+	return f.Name()
+}
+
+func commitWithMessage(msg string, edit bool) {
+	signCommits()
+	// a file keeps the quotes in msg intact
+	fn := writeMsgFile(msg)
+	defer os.Remove(fn)
+
+	if edit {
+		mygo.NewCmd("git", "commit", "-e", "-F", fn).Interactive()
+	} else {
+		sh(`git commit -F "%s"`, fn)
+	}
+}
+
+func (OpList) RP_SplitCommit() {
+	mygo.ParseFlag("[commit]")
+	cm := "HEAD"
+	if flag.NArg() > 0 {
+		cm = unaliasHead(flag.Arg(0))
 	}
-	n, err := strconv.Atoi(flag.Arg(0))
-	if err != nil {
-		return flag.Arg(0), false
+	cm = sh("git rev-parse --short %s", cm)
+	tip := sh("git rev-parse --short HEAD")
+	check.T(isAncestor(cm, tip)).F("not an ancestor of HEAD", "commit", cm)
+	check.T(len(strings.Fields(sh("git rev-list --parents -n 1 %s", cm))) == 2).F("can only split a non-merge commit with a parent", "commit", cm)
+	checkWorktreeClean()
+
+	bc := CurBranch()
+	backup := bc + splitBackupSuffix
+	msg := sh("git show -s --format=%B " + cm) // cannot format because of %B
+	shQ("git branch -D %s", backup)
+	sh("git branch %s %s", backup, tip)
+	log.Printf("split commit:%s, backup:%s", cm, backup)
+
+	sh("git reset --hard %s", cm)
+	sh("git reset --mixed -N %s~", cm)
+	for i := 1; sh("git status --porcelain -uno") != ""; i++ {
+		log.Printf("choose hunks for part %d", i)
+		mygo.NewCmd("git", "add", "-p").Interactive()
+		if !hasStagedChanges() {
+			mygo.Yorn("commit all remaining changes as part %d", i)
+			// -u picks up the new files of cm, which reset -N keeps in the index, but not stray untracked files
+			gitOut("add", "-u", ":/")
+		}
+		commitWithMessage(msg, true)
 	}
-	check.T(n > 0 && n <= 9 && (n != 1 || !squash)).F("invalid n_commits", "n", n)
-	if n == 1 {
-		return "HEAD", true
+
+	if tip != cm {
+		log.Printf("replay commits [%s..%s]", cm, tip)
+		shReplay("git cherry-pick %s..%s", cm, tip)
 	}
-	return fmt.Sprintf("HEAD~%d", n-1), false
+	sh("git branch -D %s", backup)
 }
 
 func (OpList) RT_ResetToBranchOrCommit() {
@@ -789,6 +1132,15 @@ var prInTitleRe = regexp.MustCompile(`\(#[0-9]+\)$`)
 func (OpList) S_ShowStatusLocalBranches() {
 	mygo.ParseFlag("[q/b/f]")
 
+	if *jsonOut {
+		st := worktreeStatus(flag.Arg(0) == "f")
+		if flag.Arg(0) == "b" || flag.Arg(0) == "f" {
+			st.Branches = readBranches()
+		}
+		printJSON(st)
+		return
+	}
+
 	if flag.NArg() == 0 || flag.Arg(0) == "q" {
 		s := sh("git status -uno")
 		fmt.Println(s)
@@ -830,9 +1182,9 @@ func (OpList) S_ShowStatusLocalBranches() {
 		}
 	}
 	sb.WriteString(sep)
-	sb.WriteString("\n  ")
-	sb.WriteString(sh("git branch -v"))
-	fmt.Print(&sb)
+	sb.WriteString("\n")
+	sb.WriteString(branchTable(readBranches(), useColor()))
+	fmt.Println(&sb)
 }
 
 var headAliasRe = regexp.MustCompile(`^h([0-9]+)$`)
@@ -851,36 +1203,22 @@ func (OpList) SC_ShowCommitSummary() {
 	if flag.NArg() > 0 {
 		cm = unaliasHead(flag.Arg(0))
 	}
-	s := sh("git show --name-only %s", cm)
-	fmt.Println(s)
-}
-
-func (OpList) SL_ListCommits() {
-	remote := flag.Bool("r", false, "remote branch")
-	mygo.ParseFlag("[branch_re]", "[n_commits]")
-
-	var pat string
-	num := 3
-	for _, s := range flag.Args() {
-		n, err := strconv.Atoi(s)
-		if err != nil {
-			pat = s
-		} else {
-			num = n
+	if *jsonOut {
+		if cm == "" {
+			cm = "HEAD"
 		}
-	}
-
-	var br string
-	if pat != "" {
-		if *remote {
-			br = remoteBranch(pat)
-		} else {
-			br = localBranch(pat, true)
+		cd := commitDetail{
+			commitInfo: listCommits("-n 1 " + cm)[0],
+			Body:       sh("git show -s --format=%%b %s", cm),
+			Files:      []string{},
+		}
+		if s := sh(`git show --format="" --name-only %s`, cm); s != "" {
+			cd.Files = strings.Split(s, "\n")
 		}
+		printJSON(cd)
+		return
 	}
-
-	logFormat := "--format='%h    %s%n%cd    %an%n' --date=local"
-	s := sh("git log -n %d %s %s --", num, logFormat, br)
+	s := sh("git show --name-only %s", cm)
 	fmt.Println(s)
 }
 
@@ -892,6 +1230,10 @@ func (OpList) SR_ListRemoteBranches() {
 		pat = flag.Arg(0)
 	}
 	rbrs := matchRemoteBranches(pat, false, false)
+	if *jsonOut {
+		printJSON(append([]string{}, rbrs...))
+		return
+	}
 	for _, br := range rbrs {
 		fmt.Println(br)
 	}
@@ -904,18 +1246,26 @@ func (OpList) SV_ShowFileAtVersion() {
 		cm, filename = filename, cm
 	}
 	check.V(os.Stat(filename)).F("not file", "arg0", cm, "arg1", filename)
-	if !isCommit(cm) {
-		cm = localBranch(cm, true)
+	cm = resolveRev(cm)
+
+	s := sh(`git show %s:"%s"`, cm, repoPath(filename))
+	fmt.Println(s)
+}
+
+func resolveRev(s string) string {
+	s = unaliasHead(s)
+	if isCommit(s) {
+		return s
 	}
+	return localBranch(s, true)
+}
 
+func repoPath(filename string) string {
 	filename, _ = filepath.Abs(filename)
 	rd := filepath.Clean(RepoDir())
 	fn := strings.TrimPrefix(filename, rd)
 	check.T(fn != filename).F("filename not in repo", "filename", filename, "repo", rd)
-	filename = strings.TrimLeft(fn, "/")
-
-	s := sh(`git show %s:"%s"`, cm, filename)
-	fmt.Println(s)
+	return strings.TrimLeft(fn, "/")
 }
 
 func (OpList) GH_GithubPrStatus() {
@@ -927,6 +1277,8 @@ func (OpList) GH_GithubPrStatus() {
 func (OpList) GT_GithubPrDraft() {
 	draft := flag.Bool("w", false, "draft pr")
 	silent := flag.Bool("s", false, "don't open browser")
+	noEdit := flag.Bool("n", false, "don't edit pr description")
+	assign := flag.Bool("r", gitConfig("assignReviewers", "false") == "true", "request review from code owners")
 	mygo.ParseFlag("[branch_re_or_commit]")
 	var bb string
 	if flag.NArg() > 0 {
@@ -935,21 +1287,40 @@ func (OpList) GT_GithubPrDraft() {
 			bb = localBranch(bb, true)
 		}
 	}
-	var draftArg string
-	if *draft {
-		draftArg = "--draft"
+	base := bb
+	if base == "" {
+		base = MainBranch()
+	}
+	title, body := decoratePR(prDescription(base))
+	if !*noEdit {
+		title, body = editPRDescription(title, body)
 	}
 
 	bc := CurBranch()
 	sh("git push --force origin HEAD:%s", bc)
 
-	if bb == "" {
-		sh("gh pr create %s --fill", draftArg)
-	} else {
+	args := []string{"pr", "create", "-t", title, "-b", body}
+	if *draft {
+		args = append(args, "--draft")
+	}
+	files := changedFiles(base)
+	if reviewers := codeReviewers(readCodeOwners(), files); len(reviewers) > 0 {
+		if *assign {
+			args = append(args, "-r", strings.Join(reviewers, ","))
+		} else {
+			log.Printf("suggested reviewers:%v", reviewers)
+		}
+	}
+	for _, label := range pathLabels(files) {
+		args = append(args, "-l", label)
+	}
+	if bb != "" {
 		rbb := bc + tmpSuffix
 		sh("git push --force origin %s:%s", bb, rbb)
-		sh("gh pr create %s --fill -B %s", draftArg, rbb)
+		args = append(args, "-B", rbb)
 	}
+	gh(args...)
+	invalidatePRCache()
 
 	if !*silent {
 		showPR(bc)
@@ -960,54 +1331,80 @@ func showPR(br string) {
 	state := prState(br)
 	check.T(state == "OPEN").F("no pr is open", "branch", br)
 
-	url := shQ("gh pr view %s --json url -q .url", br)
+	cp, _ := lookupPR(br)
+	url := cp.URL
+	if url == "" {
+		url = shQ("gh pr view %s --json url -q .url", br)
+	}
 	check.T(url != "").F("not pr url found", "branch", br)
 	shQ(`open "%s"`, url)
 }
 
 func (OpList) GP_GithubThisPullrequest() {
 	mygo.ParseFlag("[branch_re_or_pr]")
-	var br string
-	if flag.NArg() > 0 {
-		br = flag.Arg(0)
-		lbrs := matchLocalBranches(br, true, false)
-		if len(lbrs) == 1 {
-			br = lbrs[0]
-		}
-	}
-	showPR(br)
+	showPR(prArg())
 }
 
 func (OpList) GS_GithubStatus() {
 	mygo.ParseFlag("[branch_re_or_dot]")
+	if *jsonOut && flag.NArg() == 0 {
+		prs := []prInfo{}
+		for br, cp := range loadPRCache().PRs {
+			prs = append(prs, newPRInfo(br, cp))
+		}
+		slices.SortFunc(prs, func(a, b prInfo) int { return b.Number - a.Number })
+		printJSON(prs)
+		return
+	}
 	if flag.NArg() == 0 {
 		fmt.Println(sh("gh pr status"))
 		return
 	}
 
-	bc, bm, rb := CurBranch(), MainBranch(), RepoBranch()
-
 	br := flag.Arg(0)
 	if br == "." {
-		br = bc
+		br = CurBranch()
 	} else {
 		br = localBranch(br, false)
 	}
+	if *jsonOut {
+		cp, _ := lookupPR(br)
+		printJSON(newPRInfo(br, cp))
+		return
+	}
 
-	state := prState(br)
-	if state == "MERGED" || state == "" {
-		switch br {
-		case bm, rb:
-			fmt.Println(state)
-		case bc:
-			pullMain()
-			mygo.Yorn("reset to %s", bm)
-			sh("git reset --hard %s --", bm)
-		default:
-			rbrs := matchRemoteBranches("^"+br+"$", true, true)
-			mygo.Yorn("delete local branch:%s and remote branches:%v", br, rbrs)
-			deleteBranches([]string{br}, rbrs)
-		}
+	// a fresh cache knows that a branch has no pr, but gh cannot tell no pr from an error
+	cp, known := lookupPR(br)
+	state := cp.State
+	if !known && !*offline {
+		state = shQ("gh pr view %s --json state -q .state", br)
+		known = state != ""
+	}
+	if !known {
+		log.Printf("pr state of %s is unknown", br)
+		return
+	}
+	if state != "MERGED" && state != "" {
+		log.Printf("pr of %s is not merged, state:%q", br, state)
+		return
+	}
+	cleanupBranch(br, state)
+}
+
+func cleanupBranch(br, state string) {
+	check.T(state == "MERGED" || state == "").F("pr is not merged", "branch", br, "state", state)
+	bc, bm, rb := CurBranch(), MainBranch(), RepoBranch()
+	switch br {
+	case bm, rb:
+		fmt.Println(state)
+	case bc:
+		pullMain()
+		mygo.Yorn("reset to %s", bm)
+		sh("git reset --hard %s --", bm)
+	default:
+		rbrs := matchRemoteBranches("^origin/"+regexp.QuoteMeta(br)+"$", true, true)
+		mygo.Yorn("delete local branch:%s and remote branches:%v", br, rbrs)
+		deleteBranches([]string{br}, rbrs)
 	}
 }
 
@@ -1024,6 +1421,11 @@ func (OpList) WN_WorktreeAdd() {
 }
 
 func (OpList) WL_WorktreeList() {
+	mygo.ParseFlag()
+	if *jsonOut {
+		printJSON(listWorktrees())
+		return
+	}
 	fmt.Println(sh("git worktree list"))
 }
 
@@ -1042,6 +1444,14 @@ func (OpList) WD_WorktreeRemove() {
 func (OpList) I_Head() {
 	mygo.ParseFlag()
 	br := shQ("git rev-parse --abbrev-ref HEAD")
+	if *jsonOut {
+		hi := headInfo{Branch: br, Commit: shQ("git rev-parse HEAD"), Detached: br == "HEAD"}
+		if hi.Detached {
+			hi.Branch = ""
+		}
+		printJSON(hi)
+		return
+	}
 	if br == "" {
 		return
 	}
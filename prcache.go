@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+)
+
+var offline = flag.Bool("offline", false, "use cached pr data without refreshing")
+
+type cachedPR struct {
+	Number  int
+	State   string
+	Base    string
+	URL     string
+	HeadSHA string
+	CI      string // pass, fail or pending
+}
+
+type prCache struct {
+	Refreshed time.Time
+	PRs       map[string]cachedPR
+}
+
+var prc *prCache
+
+func prCacheFile() string {
+	return filepath.Join(MygitDir(), "prs.json")
+}
+
+func prCacheTTL() time.Duration {
+	s := gitConfig("prCacheTTL", "5m")
+	return check.V(time.ParseDuration(s)).F("invalid mygit.prCacheTTL", "ttl", s)
+}
+
+func readPRCache() *prCache {
+	c := &prCache{}
+	if b, err := os.ReadFile(prCacheFile()); err == nil {
+		check.E(json.Unmarshal(b, c)).L("ignore corrupt pr cache", "file", prCacheFile())
+	}
+	return c
+}
+
+func loadPRCache() *prCache {
+	if prc != nil {
+		return prc
+	}
+	prc = readPRCache()
+	if !*offline && time.Since(prc.Refreshed) > prCacheTTL() {
+		refreshPRCache()
+	}
+	return prc
+}
+
+func refreshPRCache() {
+	var prs []struct {
+		Number            int
+		State             string
+		BaseRefName       string
+		URL               string
+		HeadRefOid        string
+		HeadRefName       string
+		StatusCheckRollup []checkRollup
+	}
+	s := shQ("gh pr list --author @me --state all --limit 200 --json number,state,baseRefName,url,headRefOid,headRefName,statusCheckRollup")
+	if s == "" || json.Unmarshal([]byte(s), &prs) != nil {
+		if !prc.Refreshed.IsZero() {
+			log.Printf("use stale pr cache refreshed at %s", prc.Refreshed.Format(time.DateTime))
+		}
+		return
+	}
+
+	prc.Refreshed = time.Now()
+	prc.PRs = make(map[string]cachedPR)
+	// prs are listed from the newest, and an open pr wins over the older ones of the same branch
+	for _, pr := range prs {
+		if old, ok := prc.PRs[pr.HeadRefName]; ok && (old.State == "OPEN" || pr.State != "OPEN") {
+			continue
+		}
+		prc.PRs[pr.HeadRefName] = cachedPR{
+			Number:  pr.Number,
+			State:   pr.State,
+			Base:    pr.BaseRefName,
+			URL:     pr.URL,
+			HeadSHA: pr.HeadRefOid,
+			CI:      ciStatus(pr.StatusCheckRollup),
+		}
+	}
+
+	b := check.V(json.MarshalIndent(prc, "", "  ")).F("marshal pr cache")
+	makeMygitDir()
+	tmp := prCacheFile() + ".tmp"
+	check.E(os.WriteFile(tmp, b, 0o644)).F("write pr cache", "file", tmp)
+	check.E(os.Rename(tmp, prCacheFile())).F("rename pr cache", "file", tmp)
+}
+
+type checkRollup struct {
+	Status     string
+	Conclusion string
+	State      string
+}
+
+func ciStatus(checks []checkRollup) string {
+	if len(checks) == 0 {
+		return ""
+	}
+	failed := []string{"FAILURE", "ERROR", "CANCELLED", "TIMED_OUT", "ACTION_REQUIRED", "STARTUP_FAILURE"}
+	st := "pass"
+	for _, c := range checks {
+		switch {
+		case slices.Contains(failed, c.Conclusion) || slices.Contains(failed, c.State):
+			return "fail"
+		case c.State == "PENDING" || c.State == "EXPECTED" || (c.Status != "" && c.Status != "COMPLETED"):
+			st = "pending"
+		}
+	}
+	return st
+}
+
+func invalidatePRCache() {
+	os.Remove(prCacheFile())
+	prc = nil
+}
+
+func lookupPR(pr string) (cp cachedPR, known bool) {
+	c := loadPRCache()
+	if pr == "" {
+		pr = CurBranch()
+	}
+	if cp, ok := c.PRs[pr]; ok {
+		return cp, true
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(pr, "#")); err == nil {
+		for _, cp := range c.PRs {
+			if cp.Number == n {
+				return cp, true
+			}
+		}
+	}
+	// a miss is known to have no pr only for my branch in a fresh cache, never offline
+	if *offline {
+		return cachedPR{}, false
+	}
+	fresh := time.Since(c.Refreshed) <= prCacheTTL()
+	return cachedPR{}, fresh && strings.HasPrefix(pr, Username()+"/")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+var prTemplateFiles = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+}
+
+const defaultPRTemplate = `{{with .Stack}}{{.}}
+
+{{end}}{{range .Commits}}- {{.}}
+{{end}}{{with .Issues}}
+Refs: {{join . ", "}}
+{{end}}
+` + "```" + `
+{{.Diffstat}}
+` + "```" + `
+`
+
+type prBody struct {
+	Branch   string
+	Base     string
+	Commits  []string
+	Diffstat string
+	Issues   []string
+	Stack    string
+}
+
+func prTemplate() string {
+	fn := gitConfig("prTemplate", "")
+	if fn == "" {
+		for _, f := range prTemplateFiles {
+			if p := filepath.Join(RepoDir(), f); mygo.FileExist(p) {
+				fn = p
+				break
+			}
+		}
+	}
+	if fn == "" {
+		return defaultPRTemplate
+	}
+	b := check.V(os.ReadFile(fn)).F("read pr template", "file", fn)
+	if !strings.Contains(string(b), "{{") {
+		return string(b) + "\n" + defaultPRTemplate
+	}
+	return string(b)
+}
+
+const defaultTicketRe = `\b[A-Z][A-Z0-9]+-[0-9]+\b`
+
+func ticketRe() *regexp.Regexp {
+	return regexp.MustCompile(gitConfig("ticketRe", defaultTicketRe))
+}
+
+var issueRefRe = regexp.MustCompile(`(?:^|\s)(#[0-9]+)\b`)
+
+func parseIssues(ss ...string) []string {
+	var issues []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			issues = append(issues, id)
+		}
+	}
+	// opt-in like branchTicket
+	var tre *regexp.Regexp
+	if configGet("mygit.ticketRe") != "" {
+		tre = ticketRe()
+	}
+	for _, s := range ss {
+		if tre != nil {
+			for _, id := range tre.FindAllString(s, -1) {
+				add(id)
+			}
+		}
+		for _, m := range issueRefRe.FindAllStringSubmatch(s, -1) {
+			add(m[1])
+		}
+	}
+	return issues
+}
+
+func stackDesc(br string) string {
+	stack := stackOf(br)
+	if len(stack) < 2 {
+		return ""
+	}
+	i := 0
+	for stack[i] != br {
+		i++
+	}
+	s := fmt.Sprintf("PR %d of %d", i+1, len(stack))
+	if i > 0 {
+		if n := prNumber(stack[i-1]); n != "" {
+			s += fmt.Sprintf(", depends on #%s", n)
+		} else {
+			s += fmt.Sprintf(", depends on %s", stack[i-1])
+		}
+	}
+	return s
+}
+
+func prNumber(br string) string {
+	if cp, _ := lookupPR(br); cp.Number > 0 {
+		return strconv.Itoa(cp.Number)
+	}
+	return ""
+}
+
+func prDescription(base string) (string, string) {
+	bc := CurBranch()
+	pb := prBody{
+		Branch:   bc,
+		Base:     base,
+		Diffstat: sh("git diff --stat %s...HEAD", base),
+		Stack:    stackDesc(bc),
+	}
+	subjects := sh("git log --reverse --format=%%s %s..HEAD", base)
+	check.T(subjects != "").F("no commit to create pr", "base", base)
+	for _, ln := range strings.Split(sh("git log --reverse --format='%%h %%s' %s..HEAD", base), "\n") {
+		pb.Commits = append(pb.Commits, ln)
+	}
+	pb.Issues = parseIssues(append([]string{bc}, strings.Split(sh("git log --format=%%B %s..HEAD", base), "\n")...)...)
+
+	funcs := template.FuncMap{"join": strings.Join}
+	tmpl := check.V(template.New("pr").Funcs(funcs).Parse(prTemplate())).F("parse pr template")
+	var sb strings.Builder
+	check.E(tmpl.Execute(&sb, pb)).F("render pr template")
+
+	title, _, _ := strings.Cut(subjects, "\n")
+	return title, sb.String()
+}
+
+func editPRDescription(title, body string) (string, string) {
+	f := check.V(os.CreateTemp("", "mygit-pr-*.md")).F("create pr file")
+	defer os.Remove(f.Name())
+	check.V(fmt.Fprintf(f, "%s\n\n%s", title, body)).F("write pr file", "file", f.Name())
+	check.E(f.Close()).F("close pr file", "file", f.Name())
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	mygo.NewCmd("/bin/sh", "-c", editor+` "$1"`, "sh", f.Name()).Interactive()
+
+	b := check.V(os.ReadFile(f.Name())).F("read pr file", "file", f.Name())
+	title, body, _ = strings.Cut(strings.TrimSpace(string(b)), "\n")
+	title = strings.TrimSpace(title)
+	check.T(title != "").F("empty pr title")
+	return title, strings.TrimSpace(body)
+}
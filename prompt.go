@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+const defaultPromptTemplate = `{{.Repo}}:{{.Branch}}` +
+	`{{if .Staged}}+{{end}}{{if .Dirty}}*{{end}}{{if .Partial}}…{{end}}` +
+	`{{if .Ahead}} ↑{{.Ahead}}{{end}}{{if .Behind}} ↓{{.Behind}}{{end}}` +
+	`{{with .Op}} |{{.}}{{end}}{{with .Stash}} ≡{{.}}{{end}}{{with .PR}} #{{.}}{{end}}`
+
+type promptInfo struct {
+	Repo     string
+	Branch   string // commit if detached
+	Detached bool
+	Op       string // rebase, cherry-pick, merge, revert or am in progress
+	Stash    int
+	PR       int
+
+	// from git status within the time budget
+	Staged  bool
+	Dirty   bool
+	Ahead   int
+	Behind  int
+	Partial bool // git status did not finish within the budget
+}
+
+func readPromptStatus(ctx context.Context, pi *promptInfo) {
+	c := exec.CommandContext(ctx, "git", "--no-optional-locks", "status", "--porcelain=v2", "-b", "-uno", "--ignore-submodules")
+	out, err := c.Output()
+	if err != nil {
+		pi.Partial = true
+		return
+	}
+	for _, ln := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(ln, "# branch.ab "):
+			fs := strings.Fields(ln)
+			pi.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fs[2], "+"))
+			pi.Behind, _ = strconv.Atoi(strings.TrimPrefix(fs[3], "-"))
+		case strings.HasPrefix(ln, "1 "), strings.HasPrefix(ln, "2 "), strings.HasPrefix(ln, "u "):
+			xy := strings.Fields(ln)[1]
+			pi.Staged = pi.Staged || xy[0] != '.'
+			pi.Dirty = pi.Dirty || xy[1] != '.'
+		}
+	}
+}
+
+func (OpList) IP_Prompt() {
+	tmplText := flag.String("t", os.Getenv("MYGIT_PROMPT"), "prompt template, default is $MYGIT_PROMPT or the builtin template")
+	budget := flag.Duration("b", 150*time.Millisecond, "time budget of git status")
+	mygo.ParseFlag()
+
+	wd := check.V(os.Getwd()).F("getwd")
+	top, gd, cd, ok := findRepo(wd)
+	if !ok {
+		return
+	}
+	// the native lookups save the helpers from running git
+	repoDir, gitDir, gitCommonDir = top, gd, cd
+
+	ctx, cancel := context.WithTimeout(context.Background(), *budget)
+	defer cancel()
+	var pi promptInfo
+	done := make(chan struct{})
+	go func() {
+		readPromptStatus(ctx, &pi)
+		close(done)
+	}()
+
+	var br string
+	if ref, detached, ok := readHead(gd); ok {
+		br = ref
+		pi.Detached = detached
+		if detached && len(ref) > 7 {
+			ref = ref[:7]
+		}
+		pi.Branch = ref
+	}
+	pi.Repo = filepath.Base(top)
+	pi.Op = inProgressOp()
+	if b, err := os.ReadFile(filepath.Join(cd, "logs/refs/stash")); err == nil {
+		pi.Stash = bytes.Count(b, []byte("\n"))
+	}
+	// the prompt is read-only, so it neither creates nor refreshes the pr cache
+	if !pi.Detached && mygo.FileExist(prCacheFile()) {
+		pi.PR = readPRCache().PRs[br].Number
+	}
+	<-done
+
+	tt := *tmplText
+	if tt == "" {
+		tt = defaultPromptTemplate
+	}
+	tmpl := check.V(template.New("prompt").Parse(tt)).F("parse prompt template")
+	var sb strings.Builder
+	check.E(tmpl.Execute(&sb, pi)).F("render prompt")
+	fmt.Print(sb.String())
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/zncoder/mygo"
+)
+
+func findRepo(dir string) (top, gd, cd string, ok bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		p := filepath.Join(d, ".git")
+		if fi, err := os.Stat(p); err == nil {
+			if fi.IsDir() {
+				return d, p, p, true
+			}
+			// a linked worktree or submodule has a .git file of "gitdir: <dir>"
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return "", "", "", false
+			}
+			gd = absPath(d, strings.TrimSpace(strings.TrimPrefix(string(b), "gitdir:")))
+			cd = gd
+			if b, err := os.ReadFile(filepath.Join(gd, "commondir")); err == nil {
+				cd = absPath(gd, strings.TrimSpace(string(b)))
+			}
+			return d, gd, cd, true
+		}
+		if filepath.Dir(d) == d {
+			return "", "", "", false
+		}
+	}
+}
+
+func absPath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(dir, p)
+}
+
+func readHead(gd string) (ref string, detached bool, ok bool) {
+	b, err := os.ReadFile(filepath.Join(gd, "HEAD"))
+	if err != nil {
+		return "", false, false
+	}
+	s := strings.TrimSpace(string(b))
+	if br, found := strings.CutPrefix(s, "ref: refs/heads/"); found {
+		return br, false, true
+	}
+	return s, true, true
+}
+
+// the native readers report !ok for a layout they don't understand, e.g. reftable, and the callers fall back to git
+
+func nativeRepo() (top, gd, cd string, ok bool) {
+	for _, env := range []string{"GIT_DIR", "GIT_WORK_TREE", "GIT_COMMON_DIR"} {
+		if os.Getenv(env) != "" {
+			return "", "", "", false
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", "", "", false
+	}
+	top, gd, cd, ok = findRepo(wd)
+	if ok && mygo.FileExist(filepath.Join(cd, "reftable")) {
+		return "", "", "", false
+	}
+	return top, gd, cd, ok
+}
+
+func readPackedRefs(cd string) map[string]string {
+	refs := make(map[string]string)
+	b, err := os.ReadFile(filepath.Join(cd, "packed-refs"))
+	if err != nil {
+		return refs
+	}
+	for _, ln := range strings.Split(string(b), "\n") {
+		if ln == "" || ln[0] == '#' || ln[0] == '^' {
+			continue
+		}
+		if sha, name, ok := strings.Cut(ln, " "); ok {
+			refs[name] = sha
+		}
+	}
+	return refs
+}
+
+func resolveRef(gd, cd, name string) (string, bool) {
+	for i := 0; i < 5; i++ {
+		dir := cd
+		if !strings.HasPrefix(name, "refs/") || strings.HasPrefix(name, "refs/bisect/") {
+			dir = gd
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			sha, ok := readPackedRefs(cd)[name]
+			return sha, ok
+		}
+		s := strings.TrimSpace(string(b))
+		target, sym := strings.CutPrefix(s, "ref: ")
+		if !sym {
+			return s, true
+		}
+		name = target
+	}
+	return "", false
+}
+
+func localBranchNames(cd string) []string {
+	seen := make(map[string]bool)
+	for name := range readPackedRefs(cd) {
+		if br, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+			seen[br] = true
+		}
+	}
+	heads := filepath.Join(cd, "refs", "heads")
+	filepath.WalkDir(heads, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !strings.HasSuffix(p, ".lock") {
+			seen[filepath.ToSlash(strings.TrimPrefix(p, heads+string(filepath.Separator)))] = true
+		}
+		return nil
+	})
+	brs := make([]string, 0, len(seen))
+	for br := range seen {
+		brs = append(brs, br)
+	}
+	slices.Sort(brs)
+	return brs
+}
+
+func worktreeDirs(cd string) (dirs, gds []string) {
+	main := ""
+	if filepath.Base(cd) == ".git" {
+		main = filepath.Dir(cd)
+	}
+	dirs, gds = append(dirs, main), append(gds, cd)
+	ents, _ := os.ReadDir(filepath.Join(cd, "worktrees"))
+	for _, ent := range ents {
+		wgd := filepath.Join(cd, "worktrees", ent.Name())
+		b, err := os.ReadFile(filepath.Join(wgd, "gitdir"))
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, filepath.Dir(absPath(wgd, strings.TrimSpace(string(b)))))
+		gds = append(gds, wgd)
+	}
+	return dirs, gds
+}
+
+func nativeBranchList() (string, bool) {
+	_, gd, cd, ok := nativeRepo()
+	if !ok {
+		return "", false
+	}
+	marks := make(map[string]string)
+	_, gds := worktreeDirs(cd)
+	for _, wgd := range gds {
+		if br, detached, ok := readHead(wgd); ok && !detached {
+			marks[br] = "+"
+		}
+	}
+	if br, detached, ok := readHead(gd); ok && !detached {
+		marks[br] = "*"
+	}
+
+	var sb strings.Builder
+	for _, br := range localBranchNames(cd) {
+		mark := marks[br]
+		if mark == "" {
+			mark = " "
+		}
+		fmt.Fprintf(&sb, "%s %s\n", mark, br)
+	}
+	return sb.String(), true
+}
+
+func nativeCurBranch() (string, bool) {
+	_, gd, cd, ok := nativeRepo()
+	if !ok {
+		return "", false
+	}
+	ref, detached, ok := readHead(gd)
+	if !ok {
+		return "", false
+	}
+	if !detached {
+		return ref, true
+	}
+	sha, ok := resolveRef(gd, cd, "HEAD")
+	if !ok || len(sha) < 7 {
+		return "", false
+	}
+	return sha[:7], true
+}
+
+type configFile map[string][]string
+
+var nativeConfig struct {
+	loaded bool
+	ok     bool
+	cfg    configFile
+}
+
+func readNativeConfig() (configFile, bool) {
+	nc := &nativeConfig
+	if !nc.loaded {
+		nc.cfg, nc.ok = loadNativeConfig()
+		nc.loaded = true
+	}
+	return nc.cfg, nc.ok
+}
+
+func loadNativeConfig() (configFile, bool) {
+	for _, env := range []string{"GIT_CONFIG", "GIT_CONFIG_GLOBAL", "GIT_CONFIG_SYSTEM", "GIT_CONFIG_COUNT", "GIT_CONFIG_PARAMETERS"} {
+		if os.Getenv(env) != "" {
+			return nil, false
+		}
+	}
+	_, gd, cd, ok := nativeRepo()
+	if !ok {
+		return nil, false
+	}
+
+	var files []string
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") == "" {
+		fn, ok := systemConfig()
+		if !ok {
+			return nil, false
+		}
+		files = append(files, fn)
+	}
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+	files = append(files, filepath.Join(cd, "config"))
+
+	cfg := make(configFile)
+	for _, fn := range files {
+		if !cfg.parse(fn, 0) {
+			return nil, false
+		}
+	}
+	if cfg.get("extensions.worktreeConfig") == "true" && !cfg.parse(filepath.Join(gd, "config.worktree"), 0) {
+		return nil, false
+	}
+	return cfg, true
+}
+
+func systemConfig() (string, bool) {
+	if fn := shQ("git var GIT_CONFIG_SYSTEM"); fn != "" {
+		return fn, true
+	}
+	// git before 2.42 cannot tell, but a distribution git in /usr/bin uses /etc
+	if fn, err := exec.LookPath("git"); err == nil && fn == "/usr/bin/git" && runtime.GOOS != "darwin" {
+		return "/etc/gitconfig", true
+	}
+	return "", false
+}
+
+func canonicalKey(key string) string {
+	i, j := strings.Index(key, "."), strings.LastIndex(key, ".")
+	if i < 0 {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:i]) + key[i:j] + strings.ToLower(key[j:])
+}
+
+func (cfg configFile) get(key string) string {
+	vs := cfg[canonicalKey(key)]
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[len(vs)-1]
+}
+
+func (cfg configFile) parse(fn string, depth int) bool {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return errors.Is(err, fs.ErrNotExist) && depth == 0
+	}
+	var section string
+	lns := strings.Split(string(b), "\n")
+	for i := 0; i < len(lns); i++ {
+		ln := strings.TrimSpace(lns[i])
+		for strings.HasSuffix(ln, `\`) && i+1 < len(lns) {
+			i++
+			ln = ln[:len(ln)-1] + lns[i]
+		}
+		if ln == "" || ln[0] == '#' || ln[0] == ';' {
+			continue
+		}
+		if ln[0] == '[' {
+			end := strings.Index(ln, "]")
+			if end < 0 {
+				return false
+			}
+			hdr := ln[1:end]
+			if name, sub, ok := strings.Cut(hdr, " "); ok {
+				sub = strings.TrimSpace(sub)
+				sub = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(strings.Trim(sub, `"`))
+				section = strings.ToLower(name) + "." + sub
+			} else {
+				section = strings.ToLower(hdr)
+			}
+			// includeIf conditions are left to git
+			if strings.HasPrefix(section, "includeif.") {
+				return false
+			}
+			if rest := strings.TrimSpace(ln[end+1:]); rest != "" && rest[0] != '#' && rest[0] != ';' {
+				return false
+			}
+			continue
+		}
+
+		name, raw, hasValue := strings.Cut(ln, "=")
+		key := section + "." + strings.ToLower(strings.TrimSpace(name))
+		val := "true"
+		if hasValue {
+			val = configValue(raw)
+		}
+		if key == "include.path" {
+			if depth > 10 {
+				return false
+			}
+			if strings.HasPrefix(val, "~/") {
+				home, _ := os.UserHomeDir()
+				val = filepath.Join(home, val[2:])
+			}
+			if !cfg.parse(absPath(filepath.Dir(fn), val), depth+1) {
+				return false
+			}
+			continue
+		}
+		cfg[key] = append(cfg[key], val)
+	}
+	return true
+}
+
+func configValue(raw string) string {
+	var sb strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b':
+				sb.WriteString("\b")
+			default:
+				sb.WriteByte(raw[i])
+			}
+		case !quoted && (c == '#' || c == ';'):
+			return strings.TrimSpace(sb.String())
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func configValues(key string) []string {
+	if cfg, ok := readNativeConfig(); ok {
+		return cfg[canonicalKey(key)]
+	}
+	s := shQ("git config --get-all %s", key)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func configGet(key string) string {
+	if cfg, ok := readNativeConfig(); ok {
+		return cfg.get(key)
+	}
+	return shQ("git config --get %s", key)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testRepo is a repo with loose and packed refs, linked worktrees on a detached HEAD and on a branch,
+// and a config with an include, in an isolated HOME.
+type testRepo struct {
+	t    *testing.T
+	dir  string // main worktree
+	wt   string // linked worktree
+	home string
+}
+
+func (r testRepo) git(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func newTestRepo(t *testing.T) testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git")
+	}
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testRepo{t: t, dir: filepath.Join(root, "repo"), wt: filepath.Join(root, "wt"), home: filepath.Join(root, "home")}
+	t.Setenv("HOME", r.home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(r.home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, env := range []string{"GIT_DIR", "GIT_WORK_TREE", "GIT_COMMON_DIR", "GIT_CONFIG", "GIT_CONFIG_GLOBAL", "GIT_CONFIG_COUNT", "GIT_CONFIG_PARAMETERS"} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	nativeConfig.loaded = false
+	t.Cleanup(func() { nativeConfig.loaded = false })
+
+	if err := os.MkdirAll(r.home, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(r.home, ".gitconfig"), []byte("[user]\n\tname = Test\n\temail = t@example.com\n[include]\n\tpath = ~/extra.gitconfig\n"), 0o644)
+	os.WriteFile(filepath.Join(r.home, "extra.gitconfig"), []byte("[mygit]\n\tkeep = .env\n\tkeep = \"*.local\" ; comment\n[remote \"Origin\"]\n\turl = https://example.com/a/b.git\n"), 0o644)
+
+	r.git(root, "init", "-q", "-b", "main", r.dir)
+	r.git(r.dir, "commit", "-q", "--allow-empty", "-m", "first")
+	r.git(r.dir, "branch", "packed")
+	r.git(r.dir, "branch", "u/nested")
+	r.git(r.dir, "tag", "v1")
+	r.git(r.dir, "pack-refs", "--all")
+	r.git(r.dir, "commit", "-q", "--allow-empty", "-m", "second")
+	r.git(r.dir, "branch", "loose")
+	r.git(r.dir, "config", "mygit.lint", "true")
+	r.git(r.dir, "config", "Core.IgnoreCase", "false")
+	r.git(r.dir, "worktree", "add", "-q", "--detach", r.wt, "HEAD~")
+	r.git(r.dir, "worktree", "add", "-q", filepath.Join(root, "wt2"), "loose")
+	return r
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestFindRepo(t *testing.T) {
+	r := newTestRepo(t)
+	for _, dir := range []string{r.dir, r.wt, filepath.Join(r.dir, ".git", "refs")} {
+		top, gd, cd, ok := findRepo(dir)
+		if !ok {
+			t.Fatalf("findRepo(%s) not ok", dir)
+		}
+		if dir != filepath.Join(r.dir, ".git", "refs") {
+			if want := r.git(dir, "rev-parse", "--show-toplevel"); top != want {
+				t.Errorf("findRepo(%s) top = %s, want %s", dir, top, want)
+			}
+		}
+		if want := r.git(dir, "rev-parse", "--path-format=absolute", "--git-dir"); gd != want {
+			t.Errorf("findRepo(%s) git dir = %s, want %s", dir, gd, want)
+		}
+		if want := r.git(dir, "rev-parse", "--path-format=absolute", "--git-common-dir"); cd != want {
+			t.Errorf("findRepo(%s) common dir = %s, want %s", dir, cd, want)
+		}
+	}
+}
+
+func TestReadHead(t *testing.T) {
+	r := newTestRepo(t)
+	_, gd, cd, _ := findRepo(r.dir)
+	ref, detached, ok := readHead(gd)
+	if want := r.git(r.dir, "rev-parse", "--abbrev-ref", "HEAD"); !ok || detached || ref != want {
+		t.Errorf("readHead(main) = %s %t %t, want %s", ref, detached, ok, want)
+	}
+
+	_, wgd, _, _ := findRepo(r.wt)
+	ref, detached, ok = readHead(wgd)
+	if want := r.git(r.wt, "rev-parse", "HEAD"); !ok || !detached || ref != want {
+		t.Errorf("readHead(worktree) = %s %t %t, want detached %s", ref, detached, ok, want)
+	}
+	if sha, ok := resolveRef(wgd, cd, "HEAD"); !ok || sha != r.git(r.wt, "rev-parse", "HEAD") {
+		t.Errorf("resolveRef(worktree HEAD) = %s %t", sha, ok)
+	}
+
+	chdir(t, r.wt)
+	if br, ok := nativeCurBranch(); !ok || br != r.git(r.wt, "rev-parse", "--short=7", "HEAD") {
+		t.Errorf("nativeCurBranch(worktree) = %s %t", br, ok)
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	r := newTestRepo(t)
+	_, gd, cd, _ := findRepo(r.dir)
+	for _, name := range []string{"HEAD", "refs/heads/main", "refs/heads/packed", "refs/heads/loose", "refs/heads/u/nested", "refs/tags/v1"} {
+		sha, ok := resolveRef(gd, cd, name)
+		if want := r.git(r.dir, "rev-parse", name); !ok || sha != want {
+			t.Errorf("resolveRef(%s) = %s %t, want %s", name, sha, ok, want)
+		}
+	}
+	if sha, ok := resolveRef(gd, cd, "refs/heads/none"); ok {
+		t.Errorf("resolveRef(none) = %s, want not found", sha)
+	}
+}
+
+func TestLocalBranchNames(t *testing.T) {
+	r := newTestRepo(t)
+	_, _, cd, _ := findRepo(r.wt)
+	got := localBranchNames(cd)
+	want := strings.Split(r.git(r.dir, "for-each-ref", "--format=%(refname:short)", "refs/heads"), "\n")
+	if !slices.Equal(got, want) {
+		t.Errorf("localBranchNames = %q, want %q", got, want)
+	}
+
+	chdir(t, r.dir)
+	s, ok := nativeBranchList()
+	if want := r.git(r.dir, "branch", "--list"); !ok || strings.TrimSpace(s) != want {
+		t.Errorf("nativeBranchList = %q, want %q", s, want)
+	}
+}
+
+func TestWorktreeDirs(t *testing.T) {
+	r := newTestRepo(t)
+	_, _, cd, _ := findRepo(r.dir)
+	dirs, _ := worktreeDirs(cd)
+	var want []string
+	for _, ln := range strings.Split(r.git(r.dir, "worktree", "list", "--porcelain"), "\n") {
+		if d, ok := strings.CutPrefix(ln, "worktree "); ok {
+			want = append(want, d)
+		}
+	}
+	// git lists the linked worktrees in the order of readdir
+	slices.Sort(want[1:])
+	if !slices.Equal(dirs, want) {
+		t.Errorf("worktreeDirs = %q, want %q", dirs, want)
+	}
+}
+
+func TestNativeConfig(t *testing.T) {
+	r := newTestRepo(t)
+	chdir(t, r.wt)
+	cfg, ok := loadNativeConfig()
+	if !ok {
+		t.Fatal("loadNativeConfig not ok")
+	}
+	for _, key := range []string{"user.name", "user.email", "mygit.lint", "core.ignorecase", "CORE.IGNORECASE", "remote.Origin.url", "mygit.keep", "mygit.none"} {
+		want, _ := exec.Command("git", "-C", r.wt, "config", "--get", key).Output()
+		if got := cfg.get(key); got != strings.TrimSpace(string(want)) {
+			t.Errorf("config %s = %q, want %q", key, got, want)
+		}
+	}
+	want := strings.Split(r.git(r.wt, "config", "--get-all", "mygit.keep"), "\n")
+	if got := cfg[canonicalKey("mygit.keep")]; !slices.Equal(got, want) {
+		t.Errorf("config --get-all mygit.keep = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+type semver struct {
+	Prefix              string
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+var semverRe = regexp.MustCompile(`^(v?)([0-9]+)\.([0-9]+)\.([0-9]+)(?:-([0-9A-Za-z.-]+))?$`)
+
+func parseSemver(s string) (semver, bool) {
+	mo := semverRe.FindStringSubmatch(s)
+	if mo == nil {
+		return semver{}, false
+	}
+	v := semver{Prefix: mo[1], Pre: mo[5]}
+	v.Major, _ = strconv.Atoi(mo[2])
+	v.Minor, _ = strconv.Atoi(mo[3])
+	v.Patch, _ = strconv.Atoi(mo[4])
+	return v, true
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+func (v semver) compare(o semver) int {
+	if c := v.Major - o.Major; c != 0 {
+		return c
+	}
+	if c := v.Minor - o.Minor; c != 0 {
+		return c
+	}
+	if c := v.Patch - o.Patch; c != 0 {
+		return c
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	a, b := strings.Split(v.Pre, "."), strings.Split(o.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, xerr := strconv.Atoi(a[i])
+		y, yerr := strconv.Atoi(b[i])
+		switch {
+		case xerr == nil && yerr == nil && x != y:
+			return x - y
+		case xerr == nil && yerr != nil:
+			return -1
+		case xerr != nil && yerr == nil:
+			return 1
+		case a[i] != b[i]:
+			return strings.Compare(a[i], b[i])
+		}
+	}
+	return len(a) - len(b)
+}
+
+func (v semver) bump(level string) semver {
+	n := semver{Prefix: v.Prefix, Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	switch level {
+	case "major":
+		n.Major, n.Minor, n.Patch = v.Major+1, 0, 0
+	case "minor":
+		n.Minor, n.Patch = v.Minor+1, 0
+	case "patch":
+		if v.Pre == "" {
+			n.Patch++
+		}
+	default:
+		check.F("unknown bump level", "level", level)
+	}
+	return n
+}
+
+type tagInfo struct {
+	Name    string    `json:"name"`
+	Commit  string    `json:"commit"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	Signed  bool      `json:"signed"`
+	version semver
+}
+
+func semverTags(merged bool) []tagInfo {
+	args := ""
+	if merged {
+		args = "--merged HEAD"
+	}
+	s := sh("git for-each-ref --format='%s' %s refs/tags",
+		"%(refname:short)%00%(objectname:short)%00%(*objectname:short)%00%(creatordate:iso-strict)%00%(contents:subject)%00%(contents:signature)%1e", args)
+	tags := []tagInfo{}
+	for _, rec := range strings.Split(s, "\x1e") {
+		fs := strings.Split(strings.TrimSpace(rec), "\x00")
+		if len(fs) != 6 {
+			continue
+		}
+		v, ok := parseSemver(fs[0])
+		if !ok {
+			continue
+		}
+		// an annotated tag points to the tag object, which peels to the commit
+		cm := fs[1]
+		if fs[2] != "" {
+			cm = fs[2]
+		}
+		t, _ := time.Parse(time.RFC3339, fs[3])
+		tags = append(tags, tagInfo{Name: fs[0], Commit: cm, Date: t, Subject: fs[4], Signed: fs[5] != "", version: v})
+	}
+	slices.SortStableFunc(tags, func(a, b tagInfo) int { return b.version.compare(a.version) })
+	return tags
+}
+
+func lastRelease() (tagInfo, bool) {
+	for _, t := range semverTags(true) {
+		if t.version.Pre == "" {
+			return t, true
+		}
+	}
+	return tagInfo{}, false
+}
+
+type convCommit struct {
+	Hash     string   `json:"hash"`
+	Type     string   `json:"type"`
+	Scope    string   `json:"scope"`
+	Subject  string   `json:"subject"`
+	Breaking bool     `json:"breaking"`
+	PR       int      `json:"pr"`
+	Labels   []string `json:"labels"`
+}
+
+var (
+	convCommitRe = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?: *(.+)$`)
+	breakingRe   = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+)
+
+func parseConvCommit(hash, subject, body string) convCommit {
+	cc := convCommit{Hash: hash, Subject: subject, Labels: []string{}}
+	if mo := prInTitleRe.FindString(subject); mo != "" {
+		cc.PR, _ = strconv.Atoi(strings.Trim(mo, "(#)"))
+		cc.Subject = strings.TrimSpace(strings.TrimSuffix(subject, mo))
+	}
+	if mo := convCommitRe.FindStringSubmatch(cc.Subject); mo != nil {
+		cc.Type, cc.Scope, cc.Breaking, cc.Subject = strings.ToLower(mo[1]), mo[2], mo[3] != "", mo[4]
+	}
+	cc.Breaking = cc.Breaking || breakingRe.MatchString(body)
+	return cc
+}
+
+func releaseCommits(rng string) []convCommit {
+	s := sh("git log --reverse --no-merges --format=%s %s", "%h%x00%s%x00%b%x1e", rng)
+	ccs := []convCommit{}
+	for _, rec := range strings.Split(s, "\x1e") {
+		fs := strings.Split(strings.TrimSpace(rec), "\x00")
+		if len(fs) != 3 {
+			continue
+		}
+		ccs = append(ccs, parseConvCommit(fs[0], fs[1], fs[2]))
+	}
+	return ccs
+}
+
+func bumpLevel(ccs []convCommit) string {
+	level := "patch"
+	for _, cc := range ccs {
+		if cc.Breaking {
+			return "major"
+		}
+		if cc.Type == "feat" {
+			level = "minor"
+		}
+	}
+	return level
+}
+
+func (OpList) TL_ListTags() {
+	merged := flag.Bool("m", false, "only tags reachable from HEAD")
+	mygo.ParseFlag()
+	tags := semverTags(*merged)
+	if *jsonOut {
+		printJSON(tags)
+		return
+	}
+	for _, t := range tags {
+		signed := ""
+		if t.Signed {
+			signed = " (signed)"
+		}
+		fmt.Printf("%-16s %s %s %s%s\n", t.Name, t.Commit, t.Date.Format(time.DateOnly), t.Subject, signed)
+	}
+}
+
+func nextRelease(version string, zeroMinor bool) (semver, []convCommit) {
+	last, ok := lastRelease()
+	rng := "HEAD"
+	if ok {
+		rng = last.Name + "..HEAD"
+	}
+	ccs := releaseCommits(rng)
+	check.T(len(ccs) > 0).F("no commits since last release", "tag", last.Name)
+
+	cur := semver{Prefix: "v"}
+	if ok {
+		cur = last.version
+	}
+	switch version {
+	case "":
+		level := bumpLevel(ccs)
+		if level == "major" && zeroMinor && cur.Major == 0 {
+			log.Printf("bump minor for the breaking changes before 1.0.0 (-z)")
+			level = "minor"
+		}
+		return cur.bump(level), ccs
+	case "major", "minor", "patch":
+		return cur.bump(version), ccs
+	}
+	v, vok := parseSemver(version)
+	check.T(vok).F("invalid version", "version", version)
+	if v.Prefix == "" {
+		v.Prefix = cur.Prefix
+	}
+	check.T(!ok || v.compare(cur) > 0).F("version not after last release", "version", version, "last", last.Name)
+	return v, ccs
+}
+
+func (OpList) TN_NextVersion() {
+	zeroMinor := flag.Bool("z", false, "bump minor for breaking changes before 1.0.0")
+	mygo.ParseFlag("[major/minor/patch/version]")
+	v, ccs := nextRelease(flag.Arg(0), *zeroMinor)
+	if *jsonOut {
+		printJSON(struct {
+			Version string       `json:"version"`
+			Commits []convCommit `json:"commits"`
+		}{v.String(), ccs})
+		return
+	}
+	fmt.Println(v)
+}
+
+func (OpList) TR_Release() {
+	dryRun := flag.Bool("n", false, "dry run, print the version and notes only")
+	sign := flag.Bool("s", signingMode(), "create a signed tag")
+	local := flag.Bool("l", false, "don't push the tag")
+	zeroMinor := flag.Bool("z", false, "bump minor for breaking changes before 1.0.0")
+	mygo.ParseFlag("[major/minor/patch/version]")
+
+	v, ccs := nextRelease(flag.Arg(0), *zeroMinor)
+	tag := v.String()
+	check.T(shQ("git rev-parse -q --verify refs/tags/%s", tag) == "").F("tag exists", "tag", tag)
+	notes := changelogSection(tag, time.Now(), groupChanges(ccs, false), repoURL())
+
+	mode := "-a"
+	if *sign {
+		mode = "-s"
+	}
+	if *dryRun {
+		fmt.Printf("version: %s\ncommit: %s\n\n%s\n", tag, sh("git rev-parse --short HEAD"), notes)
+		fmt.Printf("git tag %s %s -F <notes>\n", mode, tag)
+		if !*local {
+			fmt.Printf("git push origin refs/tags/%s\n", tag)
+		}
+		return
+	}
+
+	fmt.Println(notes)
+	mygo.Yorn("tag %s at %s", tag, sh("git log -n 1 --format='%s'", "%h %s"))
+	fn := writeMsgFile(fmt.Sprintf("Release %s\n\n%s", tag, notes))
+	defer os.Remove(fn)
+	sh(`git tag %s --cleanup=verbatim %s -F "%s"`, mode, tag, fn)
+	if !*local {
+		sh("git push origin refs/tags/%s", tag)
+	}
+	log.Printf("released %s", tag)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+func rerereDir() string {
+	return filepath.Join(GitCommonDir(), "rr-cache")
+}
+
+func enableRerere() {
+	if configGet("rerere.enabled") == "" {
+		log.Printf("enable rerere")
+		sh("git config rerere.enabled true")
+		nativeConfig.loaded = false
+	}
+}
+
+func rerereUsage() map[string]time.Time {
+	usage := make(map[string]time.Time)
+	ents, _ := os.ReadDir(rerereDir())
+	for _, ent := range ents {
+		// git touches the postimage when it replays a resolution
+		if fi, err := os.Stat(filepath.Join(rerereDir(), ent.Name(), "postimage")); err == nil {
+			usage[ent.Name()] = fi.ModTime()
+		}
+	}
+	return usage
+}
+
+func showReplayed(before map[string]time.Time) {
+	var ids []string
+	for id, t := range rerereUsage() {
+		if bt, ok := before[id]; ok && t.After(bt) {
+			ids = append(ids, id[:8])
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	slices.Sort(ids)
+	var files []string
+	if inProgressOp() != "" {
+		for _, f := range conflictFiles() {
+			if !hasConflictMarkers(f) {
+				files = append(files, f)
+			}
+		}
+	}
+	log.Printf("rerere replayed %d recorded resolutions:%v files:%v", len(ids), ids, files)
+}
+
+func shReplay(s string, args ...any) {
+	if len(args) > 0 {
+		s = fmt.Sprintf(s, args...)
+	}
+	if *verbose {
+		log.Println(s)
+	}
+
+	enableRerere()
+	signCommits()
+	used := rerereUsage()
+	code := mygo.NewCmd("/bin/sh", "-c", s).Silent(!*verbose).RunWithExitCode()
+	showReplayed(used)
+	if code != 0 {
+		if op := inProgressOp(); op != "" {
+			showConflicts(op)
+		}
+		check.F("cmd failed", "cmd", s)
+	}
+}
+
+func rerereID(prefix string) string {
+	var ids []string
+	for id := range rerereUsage() {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	check.T(len(ids) == 1).F("not unique resolution", "id", prefix, "matched", ids)
+	return ids[0]
+}
+
+func (OpList) XR_Rerere() {
+	mygo.ParseFlag("[list/show/forget/gc/on/off]", "[id_or_path]")
+	cmd := "list"
+	if flag.NArg() > 0 {
+		cmd = flag.Arg(0)
+	}
+
+	switch cmd {
+	case "on", "off":
+		sh("git config rerere.enabled %t", cmd == "on")
+	case "gc":
+		sh("git rerere gc")
+	case "list":
+		usage := rerereUsage()
+		ids := make([]string, 0, len(usage))
+		for id := range usage {
+			ids = append(ids, id)
+		}
+		slices.SortFunc(ids, func(a, b string) int { return usage[b].Compare(usage[a]) })
+		for _, id := range ids {
+			pre, _ := os.ReadFile(filepath.Join(rerereDir(), id, "preimage"))
+			n := strings.Count(string(pre), "\n<<<<<<<")
+			if strings.HasPrefix(string(pre), "<<<<<<<") {
+				n++
+			}
+			fmt.Printf("%s\t%s\t%d hunks\n", id[:8], usage[id].Format(time.DateTime), n)
+		}
+	case "show":
+		check.T(flag.NArg() > 1).F("no resolution id")
+		dir := filepath.Join(rerereDir(), rerereID(flag.Arg(1)))
+		fmt.Println(shQ("git diff --no-index %s/preimage %s/postimage", dir, dir))
+	case "forget":
+		check.T(flag.NArg() > 1).F("no resolution id or path")
+		arg := flag.Arg(1)
+		if slices.Contains(conflictFiles(), arg) {
+			gitOut("-C", RepoDir(), "rerere", "forget", arg)
+			return
+		}
+		id := rerereID(arg)
+		mygo.Yorn("forget resolution %s", id[:8])
+		check.E(os.RemoveAll(filepath.Join(rerereDir(), id))).F("remove resolution", "id", id)
+	default:
+		check.F("unknown rerere command", "cmd", cmd)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+func signingMode() bool {
+	return configBool("sign", false)
+}
+
+var signing bool
+
+func signCommits() {
+	if signing || !signingMode() {
+		return
+	}
+	checkSigningKey()
+	// the git processes run by mygit inherit the config in the env
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", n), "commit.gpgSign")
+	os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", n), "true")
+	os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(n+1))
+	signing = true
+}
+
+func signingFormat() string {
+	if f := configGet("gpg.format"); f != "" {
+		return f
+	}
+	return "openpgp"
+}
+
+func signingProgram(format string) string {
+	prog := configGet(fmt.Sprintf("gpg.%s.program", format))
+	if prog == "" && format == "openpgp" {
+		prog = configGet("gpg.program")
+	}
+	if prog == "" {
+		prog = map[string]string{"openpgp": "gpg", "x509": "gpgsm", "ssh": "ssh-keygen"}[format]
+	}
+	return prog
+}
+
+func checkSigningKey() {
+	format := signingFormat()
+	prog := signingProgram(format)
+	check.T(prog != "").F("unknown gpg.format", "format", format)
+	check.V(exec.LookPath(prog)).F("signing program not found", "format", format, "program", prog)
+
+	key := configGet("user.signingkey")
+	switch format {
+	case "ssh":
+		if key == "" {
+			check.T(configGet("gpg.ssh.defaultKeyCommand") != "").F("set user.signingkey to an ssh key")
+			return
+		}
+		if strings.HasPrefix(key, "key::") || strings.HasPrefix(key, "ssh-") {
+			return
+		}
+		if rest, ok := strings.CutPrefix(key, "~/"); ok {
+			key = filepath.Join(check.V(os.UserHomeDir()).F("home dir"), rest)
+		}
+		check.T(mygo.FileExist(key)).F("ssh signing key not found", "key", key)
+	default:
+		if key == "" {
+			key = configGet("user.email")
+		}
+		code := mygo.NewCmd(prog, "--list-secret-keys", key).Silent(true).RunWithExitCode()
+		check.T(code == 0).F("no secret key to sign", "program", prog, "key", key)
+	}
+}
+
+type signatureInfo struct {
+	Hash    string `json:"hash"`
+	Status  string `json:"status"`
+	Signer  string `json:"signer"`
+	Key     string `json:"key"`
+	Subject string `json:"subject"`
+}
+
+var signatureStatus = map[string]string{
+	"G": "good",
+	"U": "good, unknown validity",
+	"X": "good, expired",
+	"Y": "good, expired key",
+	"R": "good, revoked key",
+	"E": "cannot check",
+	"B": "bad",
+	"N": "unsigned",
+}
+
+func (si signatureInfo) ok() bool {
+	return si.Status == "G" || si.Status == "U"
+}
+
+func commitSignatures(rng string) []signatureInfo {
+	if signingFormat() == "ssh" {
+		fn := configGet("gpg.ssh.allowedSignersFile")
+		check.T(fn != "").F("set gpg.ssh.allowedSignersFile to verify ssh signatures")
+	}
+	s := sh("git log --format=%s %s", "%h%x00%G?%x00%GS%x00%GK%x00%s%x1e", rng)
+	sis := []signatureInfo{}
+	for _, rec := range strings.Split(s, "\x1e") {
+		fs := strings.Split(strings.TrimSpace(rec), "\x00")
+		if len(fs) != 5 {
+			continue
+		}
+		sis = append(sis, signatureInfo{Hash: fs[0], Status: fs[1], Signer: fs[2], Key: fs[3], Subject: fs[4]})
+	}
+	return sis
+}
+
+func trunkRef() string {
+	base := "origin/" + MainBranch()
+	if shQ("git rev-parse -q --verify %s", base) == "" {
+		base = MainBranch()
+	}
+	return base
+}
+
+func unpushedRange() string {
+	return trunkRef() + "..HEAD"
+}
+
+func verifyUnpushed() {
+	if !signingMode() {
+		return
+	}
+	failed := false
+	for _, si := range commitSignatures(unpushedRange()) {
+		if !si.ok() {
+			log.Printf("signature %s: %s, %s", si.Hash, signatureStatus[si.Status], si.Subject)
+			failed = true
+		}
+	}
+	check.T(!failed).F("commits not signed well, vs -r to re-sign, -n to skip")
+}
+
+func (OpList) VS_VerifySignatures() {
+	resign := flag.Bool("r", false, "re-sign the unpushed commits")
+	mygo.ParseFlag("[range]")
+	rng := unpushedRange()
+	if flag.NArg() > 0 {
+		rng = flag.Arg(0)
+	}
+	if *resign {
+		check.T(signingMode()).F("not in signing mode, set mygit.sign")
+		base, _, _ := strings.Cut(rng, "..")
+		checkWorktreeClean()
+		signCommits()
+		shReplay("git rebase --force-rebase %s", sh("git merge-base %s HEAD", base))
+	}
+	sis := commitSignatures(rng)
+	if *jsonOut {
+		printJSON(sis)
+		return
+	}
+	bad := 0
+	for _, si := range sis {
+		mark := " "
+		if !si.ok() {
+			mark = "!"
+			bad++
+		}
+		fmt.Printf("%s %s %-24s %-20s %s\n", mark, si.Hash, signatureStatus[si.Status], si.Signer, si.Subject)
+	}
+	check.T(bad == 0).F("commits not signed well", "count", bad)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+type stashInfo struct {
+	Index  int       `json:"index"`
+	Ref    string    `json:"ref"`
+	Branch string    `json:"branch"`
+	Name   string    `json:"name"`
+	Date   time.Time `json:"date"`
+}
+
+var stashSubjectRe = regexp.MustCompile(`^(WIP on|On) ([^:]+): (.*)$`)
+
+const autoStashName = "mygit-autostash"
+
+func listStashes() []stashInfo {
+	s := sh("git stash list --format=%s", "%gd%x00%gs%x00%ct")
+	sts := []stashInfo{}
+	for i, ln := range strings.Split(s, "\n") {
+		fs := strings.Split(ln, "\x00")
+		if len(fs) != 3 {
+			continue
+		}
+		st := stashInfo{Index: i, Ref: fs[0], Name: fs[1]}
+		if mo := stashSubjectRe.FindStringSubmatch(fs[1]); mo != nil {
+			st.Branch, st.Name = mo[2], ""
+			if mo[1] == "On" {
+				st.Name = mo[3]
+			}
+		}
+		ct, _ := strconv.ParseInt(fs[2], 10, 64)
+		st.Date = time.Unix(ct, 0)
+		sts = append(sts, st)
+	}
+	return sts
+}
+
+func branchStashes(br string) []stashInfo {
+	var sts []stashInfo
+	for _, st := range listStashes() {
+		if st.Branch == br {
+			sts = append(sts, st)
+		}
+	}
+	return sts
+}
+
+func findStash(arg string) stashInfo {
+	sts := listStashes()
+	if n, err := strconv.Atoi(arg); err == nil {
+		arg = fmt.Sprintf("stash@{%d}", n)
+	}
+	// a name matches on the current branch first, then on any branch
+	bc := CurBranch()
+	for _, st := range sts {
+		if st.Ref == arg || (st.Branch == bc && (arg == "" || st.Name == arg)) {
+			return st
+		}
+	}
+	if arg != "" {
+		for _, st := range sts {
+			if st.Name == arg {
+				return st
+			}
+		}
+	}
+	check.F("stash not found, ml -a to list all", "stash", arg, "branch", bc)
+	return stashInfo{}
+}
+
+func (st stashInfo) String() string {
+	name := st.Name
+	if name == "" {
+		name = "(unnamed)"
+	}
+	return fmt.Sprintf("%-10s %-20s %-5s %s", st.Ref, st.Branch, age(st.Date), name)
+}
+
+func (OpList) MH_Stash() {
+	untracked := flag.Bool("i", false, "include untracked files")
+	mygo.ParseFlag("[name]")
+	args := "push"
+	if *untracked {
+		args += " -u"
+	}
+	if flag.NArg() > 0 {
+		args += " -m " + quoteArgs(flag.Args()[:1], "")
+	}
+	sh("git stash %s", args)
+}
+
+func (OpList) MS_PopStash() {
+	apply := flag.Bool("a", false, "apply without dropping the stash")
+	mygo.ParseFlag("[name_or_index]")
+	st := findStash(flag.Arg(0))
+	op := "pop"
+	if *apply {
+		op = "apply"
+	}
+	log.Printf("%s %s", op, st)
+	sh(`git stash %s "%s"`, op, st.Ref)
+}
+
+func (OpList) ML_ListStashes() {
+	all := flag.Bool("a", false, "stashes of all branches")
+	mygo.ParseFlag()
+	sts := listStashes()
+	if !*all {
+		sts = branchStashes(CurBranch())
+	}
+	if *jsonOut {
+		if sts == nil {
+			sts = []stashInfo{}
+		}
+		printJSON(sts)
+		return
+	}
+	for _, st := range sts {
+		fmt.Println(st)
+	}
+}
+
+func (OpList) MV_ShowStash() {
+	patch := flag.Bool("p", false, "show the patch")
+	mygo.ParseFlag("[name_or_index]")
+	st := findStash(flag.Arg(0))
+	mode := "--stat"
+	if *patch {
+		mode = "-p"
+	}
+	fmt.Println(st)
+	fmt.Println(sh(`git stash show --include-untracked %s "%s"`, mode, st.Ref))
+}
+
+func (OpList) MD_DropStashes() {
+	maxAge := flag.Duration("t", 14*24*time.Hour, "drop stashes older than this")
+	all := flag.Bool("a", false, "stashes of all branches")
+	mygo.ParseFlag()
+
+	sts := listStashes()
+	if !*all {
+		sts = branchStashes(CurBranch())
+	}
+	p := prompter{r: bufio.NewReader(os.Stdin)}
+	// drop from the oldest so that the indexes of the remaining stashes don't change
+	for i := len(sts) - 1; i >= 0; i-- {
+		st := sts[i]
+		if time.Since(st.Date) < *maxAge {
+			continue
+		}
+		fmt.Println(st)
+		fmt.Println(sh(`git stash show --include-untracked --stat "%s"`, st.Ref))
+		switch p.ask("drop (y/n/q)", "n") {
+		case "y":
+			sh(`git stash drop "%s"`, st.Ref)
+		case "q":
+			return
+		}
+	}
+}
+
+func autoStash() bool {
+	return configBool("autoStash", false)
+}
+
+func stashOnLeave() {
+	if sh("git status --porcelain -uno") == "" {
+		return
+	}
+	log.Printf("auto-stash changes on %s", getCurBranch())
+	sh("git stash push -m %s", autoStashName)
+}
+
+func restoreOnReturn() {
+	br := getCurBranch()
+	for _, st := range branchStashes(br) {
+		if st.Name != autoStashName {
+			continue
+		}
+		log.Printf("restore auto-stash %s on %s", st.Ref, br)
+		if mygo.NewCmd("git", "stash", "pop", st.Ref).Silent(!*verbose).RunWithExitCode() != 0 {
+			log.Printf("cannot restore auto-stash, it is kept in %s", st.Ref)
+		}
+		return
+	}
+}
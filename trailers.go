@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+func ticketStyle() string {
+	s := gitConfig("ticketStyle", "trailer")
+	check.T(s == "trailer" || s == "prefix" || s == "none").F("invalid mygit.ticketStyle", "style", s)
+	return s
+}
+
+func branchTicket() string {
+	// opt-in, since the default pattern matches words like UTF-8 too
+	if configGet("mygit.ticketRe") == "" {
+		return ""
+	}
+	return ticketRe().FindString(CurBranch())
+}
+
+var ticketPrefixRe = regexp.MustCompile(`^\[[^\]]+\] `)
+
+func stripTicketPrefix(subject string) string {
+	return ticketPrefixRe.ReplaceAllString(subject, "")
+}
+
+func pairFile() string {
+	return filepath.Join(MygitDir(), "pair")
+}
+
+func pairAuthors() []string {
+	fn := pairFile()
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return nil
+	}
+	s := gitConfig("pairAge", "12h")
+	maxAge := check.V(time.ParseDuration(s)).F("invalid mygit.pairAge", "age", s)
+	if time.Since(fi.ModTime()) > maxAge {
+		log.Printf("pairing session expired, ignore %s", fn)
+		return nil
+	}
+	b := check.V(os.ReadFile(fn)).F("read pair file", "file", fn)
+	var authors []string
+	for _, ln := range strings.Split(string(b), "\n") {
+		if ln = strings.TrimSpace(ln); ln != "" {
+			authors = append(authors, ln)
+		}
+	}
+	return authors
+}
+
+func messageTrailers(msg string) []string {
+	var trailers []string
+	if t := branchTicket(); t != "" && ticketStyle() == "trailer" && !strings.Contains(msg, t) {
+		trailers = append(trailers, "Refs: "+t)
+	}
+	me := fmt.Sprintf("%s <%s>", configGet("user.name"), configGet("user.email"))
+	if configBool("signoff", false) {
+		trailers = append(trailers, "Signed-off-by: "+me)
+	}
+	trailers = append(trailers, configValues("mygit.trailer")...)
+	for _, a := range pairAuthors() {
+		if a != me {
+			trailers = append(trailers, "Co-authored-by: "+a)
+		}
+	}
+	return trailers
+}
+
+func decorateMessage(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if t := branchTicket(); t != "" && ticketStyle() == "prefix" && !strings.Contains(msg, t) {
+		msg = fmt.Sprintf("[%s] %s", t, msg)
+	}
+	trailers := messageTrailers(msg)
+	if len(trailers) == 0 {
+		return msg + "\n"
+	}
+
+	// addIfDifferent keeps an amended message from getting the trailers twice
+	args := []string{"interpret-trailers", "--if-exists", "addIfDifferent"}
+	for _, t := range trailers {
+		args = append(args, "--trailer", t)
+	}
+	c := mygo.NewCmd("git", args...).Silent(true)
+	c.C.Stdin = strings.NewReader(msg + "\n")
+	return string(c.Stdout())
+}
+
+func decoratePR(title, body string) (string, string) {
+	t := branchTicket()
+	if t == "" {
+		return title, body
+	}
+	switch ticketStyle() {
+	case "prefix":
+		if !strings.Contains(title, t) {
+			title = fmt.Sprintf("[%s] %s", t, title)
+		}
+	case "trailer":
+		if !strings.Contains(body, t) {
+			body = strings.TrimRight(body, "\n") + "\n\nRefs: " + t
+		}
+	}
+	return title, body
+}
+
+var authorRe = regexp.MustCompile(`^[^<>]+ <[^<>@]+@[^<>]+>$`)
+
+func resolveAuthor(a string) string {
+	if authorRe.MatchString(a) {
+		return a
+	}
+	s := shQ("git log -n 1 -i --author=%s --format=%s", quoteArgs([]string{a}, ""), `"%an <%ae>"`)
+	check.T(s != "").F("unknown author", "author", a)
+	return s
+}
+
+func (OpList) PA_Pair() {
+	end := flag.Bool("e", false, "end the pairing session")
+	mygo.ParseFlag("[co_author...]")
+
+	fn := pairFile()
+	switch {
+	case *end:
+		if err := os.Remove(fn); !os.IsNotExist(err) {
+			check.E(err).F("remove pair file", "file", fn)
+		}
+		log.Println("pairing session ended")
+	case flag.NArg() == 0:
+		for _, a := range pairAuthors() {
+			fmt.Println(a)
+		}
+	default:
+		var authors []string
+		for _, a := range flag.Args() {
+			authors = append(authors, resolveAuthor(a))
+		}
+		makeMygitDir()
+		check.E(os.WriteFile(fn, []byte(strings.Join(authors, "\n")+"\n"), 0o644)).F("write pair file", "file", fn)
+		log.Printf("pairing with %s", strings.Join(authors, ", "))
+	}
+}
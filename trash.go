@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zncoder/check"
+	"github.com/zncoder/mygo"
+)
+
+type trashEntry struct {
+	ID       string    `json:"id"`
+	Op       string    `json:"op"`
+	Time     time.Time `json:"time"`
+	Worktree string    `json:"worktree"`
+	Files    []string  `json:"files"`
+	Size     int64     `json:"size"`
+}
+
+func trashDir() string {
+	return filepath.Join(MygitDir(), "trash")
+}
+
+func (te trashEntry) dir() string {
+	return filepath.Join(trashDir(), te.ID)
+}
+
+func trashAge() time.Duration {
+	s := gitConfig("trashAge", "720h")
+	return check.V(time.ParseDuration(s)).F("invalid mygit.trashAge", "age", s)
+}
+
+func copyPath(src, dst string) int64 {
+	var size int64
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, strings.TrimPrefix(p, src))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			n, err := copyFile(p, target)
+			size += n
+			return err
+		}
+		return nil
+	})
+	check.E(err).F("copy", "src", src, "dst", dst)
+	return size
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+func trashFiles(op string, files []string) trashEntry {
+	purgeTrash(trashAge())
+
+	now := time.Now()
+	te := trashEntry{ID: fmt.Sprintf("%s-%s", now.Format("20060102-150405"), op), Op: op, Time: now, Worktree: RepoDir()}
+	for i := 2; mygo.FileExist(te.dir()); i++ {
+		te.ID = fmt.Sprintf("%s-%s-%d", now.Format("20060102-150405"), op, i)
+	}
+	check.E(os.MkdirAll(te.dir(), 0o755)).F("mkdir", "dir", te.dir())
+	prefix := sh("git rev-parse --show-prefix")
+	for _, f := range files {
+		rel := filepath.Join(prefix, f)
+		te.Size += copyPath(filepath.Join(te.Worktree, rel), filepath.Join(te.dir(), "files", rel))
+		te.Files = append(te.Files, rel)
+	}
+	b := check.V(json.MarshalIndent(te, "", "  ")).F("encode trash manifest")
+	check.E(os.WriteFile(filepath.Join(te.dir(), "manifest.json"), b, 0o644)).F("write trash manifest", "id", te.ID)
+	log.Printf("saved %d files to trash %s, mt restore %s to recover", len(te.Files), te.ID, te.ID)
+	return te
+}
+
+func listTrash() []trashEntry {
+	des, err := os.ReadDir(trashDir())
+	if err != nil {
+		check.T(os.IsNotExist(err)).F("read trash", "dir", trashDir(), "err", err)
+		return []trashEntry{}
+	}
+	tes := []trashEntry{}
+	for _, de := range des {
+		b, err := os.ReadFile(filepath.Join(trashDir(), de.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+		var te trashEntry
+		if json.Unmarshal(b, &te) == nil {
+			tes = append(tes, te)
+		}
+	}
+	slices.SortFunc(tes, func(a, b trashEntry) int { return b.Time.Compare(a.Time) })
+	return tes
+}
+
+func findTrash(arg string) trashEntry {
+	tes := listTrash()
+	if arg == "" {
+		arg = "0"
+	}
+	// an index is short, while an id starts with the date
+	if n, err := strconv.Atoi(arg); err == nil && len(arg) < 4 {
+		check.T(n < len(tes)).F("no trash entry", "index", n)
+		return tes[n]
+	}
+	var matched []trashEntry
+	for _, te := range tes {
+		if strings.HasPrefix(te.ID, arg) {
+			matched = append(matched, te)
+		}
+	}
+	check.T(len(matched) == 1).F("no unique trash entry", "entry", arg, "matched", len(matched))
+	return matched[0]
+}
+
+func purgeTrash(age time.Duration) {
+	for _, te := range listTrash() {
+		if time.Since(te.Time) > age {
+			check.E(os.RemoveAll(te.dir())).F("purge trash", "id", te.ID)
+		}
+	}
+}
+
+func samePath(a, b string) bool {
+	fa, erra := os.Lstat(a)
+	fb, errb := os.Lstat(b)
+	if erra != nil || errb != nil || fa.Mode().Type() != fb.Mode().Type() {
+		return false
+	}
+	switch {
+	case fa.Mode().IsRegular():
+		x, errx := os.ReadFile(a)
+		y, erry := os.ReadFile(b)
+		return errx == nil && erry == nil && bytes.Equal(x, y)
+	case fa.Mode()&fs.ModeSymlink != 0:
+		x, errx := os.Readlink(a)
+		y, erry := os.Readlink(b)
+		return errx == nil && erry == nil && x == y
+	}
+	return false
+}
+
+func restoreTrash(te trashEntry, paths []string, force bool) {
+	var files []string
+	for _, f := range te.Files {
+		if len(paths) == 0 || slices.ContainsFunc(paths, func(p string) bool {
+			return f == p || strings.HasPrefix(f, strings.TrimSuffix(p, "/")+"/")
+		}) {
+			files = append(files, f)
+		}
+	}
+	check.T(len(files) > 0).F("no file to restore", "entry", te.ID, "paths", paths)
+
+	for _, f := range files {
+		src, dst := filepath.Join(te.dir(), "files", f), filepath.Join(te.Worktree, f)
+		if _, err := os.Lstat(dst); err == nil && !force && !samePath(src, dst) {
+			check.F("file exists, -f to overwrite", "file", dst)
+		}
+	}
+	for _, f := range files {
+		copyPath(filepath.Join(te.dir(), "files", f), filepath.Join(te.Worktree, f))
+		log.Printf("restored %s", f)
+	}
+}
+
+func (OpList) MT_Trash() {
+	force := flag.Bool("f", false, "overwrite the changed files on restore")
+	all := flag.Bool("a", false, "purge all entries")
+	mygo.ParseFlag("[list/show/restore/purge]", "[entry]", "[file...]")
+	cmd := "list"
+	if flag.NArg() > 0 {
+		cmd = flag.Arg(0)
+	}
+
+	switch cmd {
+	case "list":
+		tes := listTrash()
+		if *jsonOut {
+			printJSON(tes)
+			return
+		}
+		for i, te := range tes {
+			fmt.Printf("%d\t%s\t%s\t%d files\t%d bytes\t%s\n", i, te.ID, age(te.Time), len(te.Files), te.Size, te.Worktree)
+		}
+	case "show":
+		te := findTrash(flag.Arg(1))
+		for _, f := range te.Files {
+			fmt.Println(f)
+		}
+	case "restore":
+		var paths []string
+		if flag.NArg() > 2 {
+			paths = flag.Args()[2:]
+		}
+		restoreTrash(findTrash(flag.Arg(1)), paths, *force)
+	case "purge":
+		if *all {
+			mygo.Yorn("purge all trash")
+			check.E(os.RemoveAll(trashDir())).F("purge trash")
+			return
+		}
+		purgeTrash(trashAge())
+	default:
+		check.F("unknown trash command", "cmd", cmd)
+	}
+}